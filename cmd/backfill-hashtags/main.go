@@ -0,0 +1,67 @@
+// Command backfill-hashtags indexes the hashtags of chirps created before
+// hashtags were extracted on write. It is safe to run more than once.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"os"
+
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/evanwiseman/chirpy/internal/entities"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+)
+
+const batchSize = 500
+
+func main() {
+	// Load .env
+	godotenv.Load()
+
+	// Load postgres database
+	dbURL := os.Getenv("DB_URL")
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		log.Fatalf("failed to open database %v", dbURL)
+	}
+	queries := database.New(db)
+	ctx := context.Background()
+
+	// Walk every chirp oldest first, one batch at a time
+	params := database.ListChirpsAscParams{Limit: batchSize}
+	var chirps, tagged int
+	for {
+		dbChirps, err := queries.ListChirpsAsc(ctx, params)
+		if err != nil {
+			log.Fatalf("failed to list chirps: %v", err)
+		}
+
+		for _, dbChirp := range dbChirps {
+			chirps++
+			tags := entities.Hashtags(dbChirp.Body)
+			if len(tags) == 0 {
+				continue
+			}
+			err = queries.CreateChirpHashtags(ctx, database.CreateChirpHashtagsParams{
+				ChirpID: dbChirp.ID,
+				Tags:    tags,
+			})
+			if err != nil {
+				log.Fatalf("failed to save hashtags for chirp %v: %v", dbChirp.ID, err)
+			}
+			tagged++
+		}
+
+		if len(dbChirps) < batchSize {
+			break
+		}
+		last := dbChirps[len(dbChirps)-1]
+		params.CursorCreatedAt = sql.NullTime{Time: last.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: last.ID, Valid: true}
+	}
+
+	log.Printf("Indexed hashtags for %d of %d chirps\n", tagged, chirps)
+}
@@ -11,6 +11,13 @@ require github.com/joho/godotenv v1.5.1
 
 require github.com/golang-jwt/jwt/v5 v5.3.0
 
+require (
+	github.com/pquerna/otp v1.5.0
+	golang.org/x/text v0.40.0
+)
+
+require github.com/boombuler/barcode v1.0.1-0.20190219062509-6c824513bacc // indirect
+
 require (
 	github.com/alexedwards/argon2id v1.0.0
 	golang.org/x/crypto v0.14.0 // indirect
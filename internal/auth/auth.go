@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"net/http"
@@ -13,8 +14,20 @@ import (
 	"github.com/google/uuid"
 )
 
+// passwordParams are the argon2id parameters new password hashes use
+var passwordParams = argon2id.DefaultParams
+
+// SetPasswordParams changes the argon2id parameters new password hashes
+// use. It must be called before any passwords are hashed.
+func SetPasswordParams(params *argon2id.Params) {
+	passwordParams = params
+}
+
 func HashPassword(password string) (string, error) {
-	hash, err := argon2id.CreateHash(password, argon2id.DefaultParams)
+	if password == "" {
+		return "", fmt.Errorf("password can't be empty")
+	}
+	hash, err := argon2id.CreateHash(password, passwordParams)
 	if err != nil {
 		return "", fmt.Errorf("unable to hash password: %v", err)
 	}
@@ -25,44 +38,178 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 	return argon2id.ComparePasswordAndHash(password, hash)
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		Subject:   userID.String(),
-	})
+// NeedsRehash reports whether hash was made with weaker parameters than
+// new hashes are, so it should be replaced the next time the password is
+// known
+func NeedsRehash(hash string) bool {
+	params, _, _, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return false
+	}
+	return params.Memory < passwordParams.Memory ||
+		params.Iterations < passwordParams.Iterations ||
+		params.Parallelism < passwordParams.Parallelism ||
+		params.SaltLength < passwordParams.SaltLength ||
+		params.KeyLength < passwordParams.KeyLength
+}
+
+// claims are the JWT claims chirpy issues. SessionID is set on access
+// tokens minted from a login session and is empty otherwise. Purpose is
+// empty on access tokens and names what any other token is for. ClientID
+// and Scope are set on access tokens issued to OAuth clients.
+type claims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid,omitempty"`
+	Purpose   string `json:"purpose,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+}
+
+// AccessToken is what a validated access token says about its bearer. ID
+// is the token's jti, which is empty on tokens issued before tokens could
+// be revoked. ClientID is uuid.Nil unless the token was issued to an OAuth
+// client, which may only use the token within Scopes.
+type AccessToken struct {
+	ID        string
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+	ClientID  uuid.UUID
+	Scopes    []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// Denylist reports whether an access token was revoked before it expired
+type Denylist interface {
+	IsRevoked(jti string) bool
+}
+
+func MakeJWT(userID uuid.UUID, keys *Keyring, expiresIn time.Duration) (string, error) {
+	return MakeSessionJWT(userID, uuid.Nil, keys, expiresIn)
+}
+
+// MakeSessionJWT makes an access token bound to a login session
+func MakeSessionJWT(userID, sessionID uuid.UUID, keys *Keyring, expiresIn time.Duration) (string, error) {
+	return keys.sign(newClaims(userID, sessionID, expiresIn))
+}
+
+// MakeClientJWT makes an access token for an OAuth client acting for the
+// user, limited to scopes
+func MakeClientJWT(userID, sessionID, clientID uuid.UUID, scopes []string, keys *Keyring, expiresIn time.Duration) (string, error) {
+	c := newClaims(userID, sessionID, expiresIn)
+	c.ClientID = clientID.String()
+	c.Scope = strings.Join(scopes, " ")
+	return keys.sign(c)
+}
+
+func newClaims(userID, sessionID uuid.UUID, expiresIn time.Duration) claims {
+	c := claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+	}
+	if sessionID != uuid.Nil {
+		c.SessionID = sessionID.String()
+	}
+	return c
+}
+
+// ValidateJWT validates an access token from a login. Tokens issued to
+// OAuth clients are rejected, they can only be used where their scopes are
+// checked.
+func ValidateJWT(tokenString string, keys *Keyring) (uuid.UUID, error) {
+	userID, _, err := ValidateSessionJWT(tokenString, keys)
+	return userID, err
+}
 
-	// tokenSecret must be a []byte for HMAC signing
-	return token.SignedString([]byte(tokenSecret))
+// ValidateSessionJWT validates an access token from a login and returns
+// the user and the session it was minted from. The session is uuid.Nil
+// when the token isn't bound to one.
+func ValidateSessionJWT(tokenString string, keys *Keyring) (uuid.UUID, uuid.UUID, error) {
+	token, err := ParseAccessToken(tokenString, keys)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	if token.ClientID != uuid.Nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("token was issued to an oauth client")
+	}
+	return token.UserID, token.SessionID, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	var claims jwt.RegisteredClaims
-	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (any, error) {
-		return []byte(tokenSecret), nil
-	})
+// ParseAccessToken validates an access token, rejecting it if the
+// keyring's denylist says it was revoked
+func ParseAccessToken(tokenString string, keys *Keyring) (AccessToken, error) {
+	var claims claims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, keys.verificationKey)
 	if err != nil {
-		return uuid.Nil, err
+		return AccessToken{}, err
 	}
 	if !token.Valid {
-		return uuid.Nil, fmt.Errorf("token is invalid")
+		return AccessToken{}, fmt.Errorf("token is invalid")
+	}
+
+	if claims.Purpose != "" {
+		return AccessToken{}, fmt.Errorf("token is not an access token")
 	}
 
 	if claims.Subject == "" {
-		return uuid.Nil, fmt.Errorf("token missing subject claim")
+		return AccessToken{}, fmt.Errorf("token missing subject claim")
 	}
 
 	userId, err := uuid.Parse(claims.Subject)
 	if err != nil {
-		return uuid.Nil, err
+		return AccessToken{}, err
+	}
+
+	sessionID := uuid.Nil
+	if claims.SessionID != "" {
+		sessionID, err = uuid.Parse(claims.SessionID)
+		if err != nil {
+			return AccessToken{}, fmt.Errorf("token has invalid session claim: %v", err)
+		}
 	}
-	return userId, nil
+
+	clientID := uuid.Nil
+	var scopes []string
+	if claims.ClientID != "" {
+		clientID, err = uuid.Parse(claims.ClientID)
+		if err != nil {
+			return AccessToken{}, fmt.Errorf("token has invalid client claim: %v", err)
+		}
+		scopes = strings.Fields(claims.Scope)
+	}
+
+	if claims.ID != "" && keys.denylist != nil && keys.denylist.IsRevoked(claims.ID) {
+		return AccessToken{}, fmt.Errorf("token has been revoked")
+	}
+
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+	return AccessToken{
+		ID:        claims.ID,
+		UserID:    userId,
+		SessionID: sessionID,
+		ClientID:  clientID,
+		Scopes:    scopes,
+		IssuedAt:  issuedAt,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
 }
 
+// GetBearerToken returns the token in the Authorization header, or else
+// the access token cookie of a browser session
 func GetBearerToken(headers http.Header) (string, error) {
 	authorization := headers.Get("Authorization")
 	if authorization == "" {
+		if token, err := getCookie(headers, AccessTokenCookie); err == nil {
+			return token, nil
+		}
 		return "", fmt.Errorf("authorization key not found")
 	}
 
@@ -71,11 +218,23 @@ func GetBearerToken(headers http.Header) (string, error) {
 }
 
 func MakeRefreshToken() (string, error) {
+	return MakeToken()
+}
+
+// MakeToken returns a random 256 bit token encoded as hex
+func MakeToken() (string, error) {
 	key := make([]byte, 32)
 	rand.Read(key)
 	return hex.EncodeToString(key), nil
 }
 
+// HashToken returns the SHA-256 of a token encoded as hex. Single-use
+// tokens are stored hashed so a database leak doesn't hand them out.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	authorization := headers.Get("Authorization")
 	if authorization == "" {
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/alexedwards/argon2id"
 	"github.com/google/uuid"
 )
 
@@ -33,20 +34,62 @@ func TestHashAndCheckPassword(t *testing.T) {
 	}
 }
 
+func TestHashEmptyPassword(t *testing.T) {
+	if _, err := HashPassword(""); err == nil {
+		t.Error("expected empty password to be rejected")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	defer SetPasswordParams(passwordParams)
+
+	weak := *argon2id.DefaultParams
+	weak.Memory = 8 * 1024
+	weak.Iterations = 1
+	SetPasswordParams(&weak)
+	weakHash, err := HashPassword("supersecret")
+	if err != nil {
+		t.Fatalf("HashPassword failed: %v", err)
+	}
+	if NeedsRehash(weakHash) {
+		t.Error("expected hash with current params not to need rehashing")
+	}
+
+	strong := weak
+	strong.Iterations = 2
+	SetPasswordParams(&strong)
+	if !NeedsRehash(weakHash) {
+		t.Error("expected hash with fewer iterations to need rehashing")
+	}
+	strongHash, err := HashPassword("supersecret")
+	if err != nil {
+		t.Fatalf("HashPassword failed: %v", err)
+	}
+
+	// Hashes stronger than the current params are kept
+	SetPasswordParams(&weak)
+	if NeedsRehash(strongHash) {
+		t.Error("expected stronger hash not to need rehashing")
+	}
+	if NeedsRehash("not a hash") {
+		t.Error("expected invalid hash not to need rehashing")
+	}
+}
+
 // ---- JWT tests ----
 
 func TestMakeAndValidateJWT(t *testing.T) {
-	secret := "testsecret"
+	keys := NewHMACKeyring("testsecret")
 	userID := uuid.New()
 
 	// Create a token
-	token, err := MakeJWT(userID, secret, time.Minute)
+	token, err := MakeJWT(userID, keys, time.Minute)
 	if err != nil {
 		t.Fatalf("MakeJWT failed: %v", err)
 	}
 
 	// Validate token
-	gotUserID, err := ValidateJWT(token, secret)
+	gotUserID, err := ValidateJWT(token, keys)
 	if err != nil {
 		t.Fatalf("ValidateJWT failed: %v", err)
 	}
@@ -55,32 +98,122 @@ func TestMakeAndValidateJWT(t *testing.T) {
 	}
 }
 
+func TestMakeAndValidateSessionJWT(t *testing.T) {
+	keys := NewHMACKeyring("testsecret")
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	token, err := MakeSessionJWT(userID, sessionID, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeSessionJWT failed: %v", err)
+	}
+
+	gotUserID, gotSessionID, err := ValidateSessionJWT(token, keys)
+	if err != nil {
+		t.Fatalf("ValidateSessionJWT failed: %v", err)
+	}
+	if gotUserID != userID || gotSessionID != sessionID {
+		t.Errorf("expected user %v and session %v, got %v and %v", userID, sessionID, gotUserID, gotSessionID)
+	}
+
+	// Tokens without a session still validate
+	token, err = MakeJWT(userID, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT failed: %v", err)
+	}
+	_, gotSessionID, err = ValidateSessionJWT(token, keys)
+	if err != nil {
+		t.Fatalf("ValidateSessionJWT failed: %v", err)
+	}
+	if gotSessionID != uuid.Nil {
+		t.Errorf("expected no session, got %v", gotSessionID)
+	}
+}
+
+type denylist map[string]bool
+
+func (d denylist) IsRevoked(jti string) bool {
+	return d[jti]
+}
+
+func TestValidateRevokedJWT(t *testing.T) {
+	keys := NewHMACKeyring("testsecret")
+	revoked := denylist{}
+	keys.SetDenylist(revoked)
+
+	token, err := MakeJWT(uuid.New(), keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT failed: %v", err)
+	}
+	parsed, err := ParseAccessToken(token, keys)
+	if err != nil {
+		t.Fatalf("ParseAccessToken failed: %v", err)
+	}
+	if parsed.ID == "" || parsed.ExpiresAt.IsZero() {
+		t.Fatalf("expected token to have a jti and expiry, got %+v", parsed)
+	}
+
+	revoked[parsed.ID] = true
+	if _, err := ValidateJWT(token, keys); err == nil {
+		t.Error("expected validation to fail with revoked token, but it succeeded")
+	}
+}
+
+func TestMakeClientJWT(t *testing.T) {
+	keys := NewHMACKeyring("testsecret")
+	userID, sessionID, clientID := uuid.New(), uuid.New(), uuid.New()
+
+	token, err := MakeClientJWT(userID, sessionID, clientID, []string{ScopeChirpsRead, ScopeChirpsWrite}, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeClientJWT failed: %v", err)
+	}
+
+	accessToken, err := ParseAccessToken(token, keys)
+	if err != nil {
+		t.Fatalf("ParseAccessToken failed: %v", err)
+	}
+	if accessToken.UserID != userID || accessToken.SessionID != sessionID || accessToken.ClientID != clientID {
+		t.Errorf("unexpected token %+v", accessToken)
+	}
+	if len(accessToken.Scopes) != 2 || accessToken.Scopes[0] != ScopeChirpsRead || accessToken.Scopes[1] != ScopeChirpsWrite {
+		t.Errorf("unexpected scopes %v", accessToken.Scopes)
+	}
+
+	// Client tokens can't stand in for a login
+	if _, err := ValidateJWT(token, keys); err == nil {
+		t.Error("expected client token to be rejected by ValidateJWT")
+	}
+	if _, _, err := ValidateSessionJWT(token, keys); err == nil {
+		t.Error("expected client token to be rejected by ValidateSessionJWT")
+	}
+}
+
 func TestValidateJWTWithWrongSecret(t *testing.T) {
-	secret := "correctsecret"
+	keys := NewHMACKeyring("correctsecret")
 	userID := uuid.New()
 
-	token, err := MakeJWT(userID, secret, time.Minute)
+	token, err := MakeJWT(userID, keys, time.Minute)
 	if err != nil {
 		t.Fatalf("MakeJWT failed: %v", err)
 	}
 
-	_, err = ValidateJWT(token, "wrongsecret")
+	_, err = ValidateJWT(token, NewHMACKeyring("wrongsecret"))
 	if err == nil {
 		t.Error("expected validation to fail with wrong secret, but it succeeded")
 	}
 }
 
 func TestValidateExpiredJWT(t *testing.T) {
-	secret := "testsecret"
+	keys := NewHMACKeyring("testsecret")
 	userID := uuid.New()
 
 	// Token expires immediately
-	token, err := MakeJWT(userID, secret, -time.Minute)
+	token, err := MakeJWT(userID, keys, -time.Minute)
 	if err != nil {
 		t.Fatalf("MakeJWT failed: %v", err)
 	}
 
-	_, err = ValidateJWT(token, secret)
+	_, err = ValidateJWT(token, keys)
 	if err == nil {
 		t.Error("expected validation to fail with expired token, but it succeeded")
 	}
@@ -123,6 +256,23 @@ func TestGetBearerToken(t *testing.T) {
 			expected: "mytoken123",
 			wantErr:  false,
 		},
+		{
+			name: "access token cookie",
+			headers: http.Header{
+				"Cookie": []string{AccessTokenCookie + "=cookietoken456"},
+			},
+			expected: "cookietoken456",
+			wantErr:  false,
+		},
+		{
+			name: "authorization header before cookie",
+			headers: http.Header{
+				"Authorization": []string{"Bearer mytoken123"},
+				"Cookie":        []string{AccessTokenCookie + "=cookietoken456"},
+			},
+			expected: "mytoken123",
+			wantErr:  false,
+		},
 	}
 
 	for _, tc := range cases {
@@ -137,3 +287,19 @@ func TestGetBearerToken(t *testing.T) {
 		})
 	}
 }
+
+func TestHashToken(t *testing.T) {
+	token, err := MakeToken()
+	if err != nil {
+		t.Fatalf("MakeToken failed: %v", err)
+	}
+	if len(token) != 64 {
+		t.Errorf("expected 64 hex characters, got %d", len(token))
+	}
+	if HashToken(token) != HashToken(token) || HashToken(token) == token {
+		t.Error("expected a stable hash that differs from the token")
+	}
+	if HashToken("abc") != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("unexpected hash %s", HashToken("abc"))
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+)
+
+// Cookies holding a browser session's tokens. The tokens are only sent to
+// the API and can't be read by scripts, while the CSRF token is readable
+// from every page so the web app can send it back in CSRFTokenHeader.
+const (
+	AccessTokenCookie  = "__Secure-chirpy_access_token"
+	RefreshTokenCookie = "__Secure-chirpy_refresh_token"
+	CSRFTokenCookie    = "__Host-chirpy_csrf_token"
+	CSRFTokenHeader    = "X-CSRF-Token"
+)
+
+// getCookie returns the value of the cookie name in headers
+func getCookie(headers http.Header, name string) (string, error) {
+	cookie, err := (&http.Request{Header: headers}).Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	if cookie.Value == "" {
+		return "", fmt.Errorf("%s cookie is empty", name)
+	}
+	return cookie.Value, nil
+}
+
+// GetRefreshToken returns the refresh token in the Authorization header,
+// or else in the refresh token cookie of a browser session
+func GetRefreshToken(headers http.Header) (string, error) {
+	if headers.Get("Authorization") != "" {
+		return GetBearerToken(headers)
+	}
+	token, err := getCookie(headers, RefreshTokenCookie)
+	if err != nil {
+		return "", fmt.Errorf("authorization key not found")
+	}
+	return token, nil
+}
+
+// HasSessionCookie reports whether a request carries the cookies of a
+// browser session
+func HasSessionCookie(headers http.Header) bool {
+	_, accessErr := getCookie(headers, AccessTokenCookie)
+	_, refreshErr := getCookie(headers, RefreshTokenCookie)
+	return accessErr == nil || refreshErr == nil
+}
+
+// ValidCSRFToken reports whether the CSRF token in CSRFTokenHeader matches
+// the CSRF token cookie. Other sites can make browsers send the cookie but
+// can't read it to set the header.
+func ValidCSRFToken(headers http.Header) bool {
+	cookie, err := getCookie(headers, CSRFTokenCookie)
+	if err != nil {
+		return false
+	}
+	header := headers.Get(CSRFTokenHeader)
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
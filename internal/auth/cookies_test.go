@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGetRefreshToken(t *testing.T) {
+	headers := http.Header{"Cookie": []string{AccessTokenCookie + "=access; " + RefreshTokenCookie + "=refresh"}}
+	token, err := GetRefreshToken(headers)
+	if err != nil || token != "refresh" {
+		t.Errorf("expected refresh token from cookie, got %q, %v", token, err)
+	}
+
+	headers.Set("Authorization", "Bearer header")
+	token, err = GetRefreshToken(headers)
+	if err != nil || token != "header" {
+		t.Errorf("expected refresh token from header, got %q, %v", token, err)
+	}
+
+	if _, err := GetRefreshToken(http.Header{}); err == nil {
+		t.Error("expected missing refresh token to fail")
+	}
+}
+
+func TestHasSessionCookie(t *testing.T) {
+	if HasSessionCookie(http.Header{"Cookie": []string{CSRFTokenCookie + "=csrf"}}) {
+		t.Error("expected a CSRF cookie alone not to be a session")
+	}
+	if !HasSessionCookie(http.Header{"Cookie": []string{RefreshTokenCookie + "=refresh"}}) {
+		t.Error("expected a refresh token cookie to be a session")
+	}
+}
+
+func TestValidCSRFToken(t *testing.T) {
+	cases := []struct {
+		name     string
+		cookie   string
+		header   string
+		expected bool
+	}{
+		{name: "matching token", cookie: CSRFTokenCookie + "=csrf123", header: "csrf123", expected: true},
+		{name: "wrong token", cookie: CSRFTokenCookie + "=csrf123", header: "csrf124", expected: false},
+		{name: "no header", cookie: CSRFTokenCookie + "=csrf123", expected: false},
+		{name: "no cookie", header: "csrf123", expected: false},
+		{name: "both empty", cookie: CSRFTokenCookie + "=", expected: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			headers := http.Header{}
+			headers.Set("Cookie", tc.cookie)
+			headers.Set(CSRFTokenHeader, tc.header)
+			if got := ValidCSRFToken(headers); got != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const minRSABits = 2048
+
+// Key is a JWT signing key identified by its kid. Keys loaded from a
+// public key file can only verify tokens.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private any
+	public  any
+}
+
+// Keyring holds every key tokens may be verified with and the one new
+// tokens are signed with. Tokens found in its denylist fail validation.
+type Keyring struct {
+	keys     map[string]*Key
+	signing  *Key
+	denylist Denylist
+}
+
+// NewHMACKeyring returns a keyring that signs and verifies HS256 tokens
+// with a shared secret. It is meant for local development, anything that
+// verifies these tokens can also mint them.
+func NewHMACKeyring(secret string) *Keyring {
+	key := &Key{
+		Method:  jwt.SigningMethodHS256,
+		private: []byte(secret),
+		public:  []byte(secret),
+	}
+	return &Keyring{
+		keys:    map[string]*Key{"": key},
+		signing: key,
+	}
+}
+
+// LoadKeyring reads every .pem file in dir, using the file name without
+// its extension as the kid. Files hold a PKCS #8 Ed25519 or RSA private
+// key, or a PKIX public key for a retired key that should only verify.
+//
+// Tokens are signed with the private key whose kid sorts last, so naming
+// keys by the date they were created, such as 2025-10-01.pem, makes the
+// newest key sign while older keys keep verifying tokens they issued.
+func LoadKeyring(dir string) (*Keyring, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+
+	k := &Keyring{keys: map[string]*Key{}}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := parseKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load key %s: %v", path, err)
+		}
+		k.keys[kid] = key
+		if key.private != nil {
+			k.signing = key
+		}
+	}
+
+	if k.signing == nil {
+		return nil, fmt.Errorf("no private keys found in %s", dir)
+	}
+	return k, nil
+}
+
+func parseKey(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	key := &Key{ID: kid}
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.private = private
+		switch private := private.(type) {
+		case ed25519.PrivateKey:
+			key.public = private.Public()
+		case *rsa.PrivateKey:
+			key.public = &private.PublicKey
+		}
+	case "PUBLIC KEY":
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.public = public
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	switch public := key.public.(type) {
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA keys must be at least %d bits", minRSABits)
+		}
+		key.Method = jwt.SigningMethodRS256
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, expected Ed25519 or RSA", key.public)
+	}
+	return key, nil
+}
+
+// AllowHMAC lets the keyring verify HS256 tokens without a kid that were
+// signed with secret, so tokens issued before switching to asymmetric
+// keys stay valid until they expire. They are never signed with it.
+func (k *Keyring) AllowHMAC(secret string) {
+	k.keys[""] = &Key{
+		Method: jwt.SigningMethodHS256,
+		public: []byte(secret),
+	}
+}
+
+// SetDenylist makes tokens validated with the keyring be checked against
+// d, so they can be revoked before they expire
+func (k *Keyring) SetDenylist(d Denylist) {
+	k.denylist = d
+}
+
+func (k *Keyring) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.Method, claims)
+	if k.signing.ID != "" {
+		token.Header["kid"] = k.signing.ID
+	}
+	return token.SignedString(k.signing.private)
+}
+
+// verificationKey picks the key a token claims to be signed with, making
+// sure the token's algorithm is the one that key uses
+func (k *Keyring) verificationKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("signing key %q does not use %s", kid, token.Method.Alg())
+	}
+	return key.public, nil
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every asymmetric key in the keyring.
+// HMAC secrets are never published.
+func (k *Keyring) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range k.keys {
+		jwk := JWK{Kid: key.ID, Alg: key.Method.Alg(), Use: "sig"}
+		switch public := key.public.(type) {
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	slices.SortFunc(jwks.Keys, func(a, b JWK) int {
+		return strings.Compare(a.Kid, b.Kid)
+	})
+	return jwks
+}
+
+// PublicKey decodes the key into the type jwt verifies with, an
+// ed25519.PublicKey, *rsa.PublicKey or *ecdsa.PublicKey
+func (j JWK) PublicKey() (any, error) {
+	switch j.Kty {
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || j.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("key %q is not a valid Ed25519 key", j.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(j.N)
+		e, errE := base64.RawURLEncoding.DecodeString(j.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("key %q is not a valid RSA key", j.Kid)
+		}
+		public := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		if public.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("key %q is shorter than %d bits", j.Kid, minRSABits)
+		}
+		return public, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("key %q uses unsupported curve %q", j.Kid, j.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(j.X)
+		y, errY := base64.RawURLEncoding.DecodeString(j.Y)
+		if errX != nil || errY != nil {
+			return nil, fmt.Errorf("key %q is not a valid EC key", j.Kid)
+		}
+		// Encode the point uncompressed so it is checked to be on the curve
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) > size || len(y) > size {
+			return nil, fmt.Errorf("key %q is not a valid EC key", j.Kid)
+		}
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		copy(point[1+size-len(x):1+size], x)
+		copy(point[1+2*size-len(y):], y)
+		public, err := ecdsa.ParseUncompressedPublicKey(curve, point)
+		if err != nil {
+			return nil, fmt.Errorf("key %q is not a valid EC key: %v", j.Kid, err)
+		}
+		return public, nil
+	}
+	return nil, fmt.Errorf("key %q has unsupported type %q", j.Kid, j.Kty)
+}
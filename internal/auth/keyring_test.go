@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func writePrivateKey(t *testing.T, dir, kid string, key any) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey failed: %v", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+}
+
+func writePublicKey(t *testing.T, dir, kid string, key any) {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey failed: %v", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+}
+
+func tokenKid(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified failed: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestKeyringRotation(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	writePrivateKey(t, dir, "2025-01-01", edKey)
+
+	keys, err := LoadKeyring(dir)
+	if err != nil {
+		t.Fatalf("LoadKeyring failed: %v", err)
+	}
+	userID := uuid.New()
+	oldToken, err := MakeJWT(userID, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT failed: %v", err)
+	}
+	if kid := tokenKid(t, oldToken); kid != "2025-01-01" {
+		t.Errorf("expected kid 2025-01-01, got %q", kid)
+	}
+
+	// Add a newer RSA key, it takes over signing
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	writePrivateKey(t, dir, "2025-02-01", rsaKey)
+	keys, err = LoadKeyring(dir)
+	if err != nil {
+		t.Fatalf("LoadKeyring failed: %v", err)
+	}
+	newToken, err := MakeJWT(userID, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT failed: %v", err)
+	}
+	if kid := tokenKid(t, newToken); kid != "2025-02-01" {
+		t.Errorf("expected kid 2025-02-01, got %q", kid)
+	}
+
+	// Tokens from both keys verify
+	for _, token := range []string{oldToken, newToken} {
+		got, err := ValidateJWT(token, keys)
+		if err != nil {
+			t.Fatalf("ValidateJWT failed: %v", err)
+		}
+		if got != userID {
+			t.Errorf("expected userID %v, got %v", userID, got)
+		}
+	}
+
+	// Retiring the old private key to a public key keeps verification
+	writePublicKey(t, dir, "2025-01-01", edKey.Public())
+	keys, err = LoadKeyring(dir)
+	if err != nil {
+		t.Fatalf("LoadKeyring failed: %v", err)
+	}
+	if _, err := ValidateJWT(oldToken, keys); err != nil {
+		t.Errorf("expected retired key to verify, got %v", err)
+	}
+
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kty != "OKP" || jwks.Keys[1].Kty != "RSA" {
+		t.Errorf("expected an Ed25519 and an RSA key, got %+v", jwks.Keys)
+	}
+}
+
+func TestKeyringRejectsUnknownKeys(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	writePrivateKey(t, dir, "current", edKey)
+	keys, err := LoadKeyring(dir)
+	if err != nil {
+		t.Fatalf("LoadKeyring failed: %v", err)
+	}
+
+	otherDir := t.TempDir()
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	writePrivateKey(t, otherDir, "other", otherKey)
+	otherKeys, err := LoadKeyring(otherDir)
+	if err != nil {
+		t.Fatalf("LoadKeyring failed: %v", err)
+	}
+
+	token, _ := MakeJWT(uuid.New(), otherKeys, time.Minute)
+	if _, err := ValidateJWT(token, keys); err == nil {
+		t.Error("expected token from an unknown key to be rejected")
+	}
+
+	// HS256 tokens are only accepted once a legacy secret is allowed
+	legacy, _ := MakeJWT(uuid.New(), NewHMACKeyring("secret"), time.Minute)
+	if _, err := ValidateJWT(legacy, keys); err == nil {
+		t.Error("expected HS256 token to be rejected")
+	}
+	keys.AllowHMAC("secret")
+	if _, err := ValidateJWT(legacy, keys); err != nil {
+		t.Errorf("expected legacy HS256 token to verify, got %v", err)
+	}
+	if _, err := MakeJWT(uuid.New(), keys, time.Minute); err != nil {
+		t.Errorf("expected keyring to keep signing, got %v", err)
+	}
+	for _, jwk := range keys.JWKS().Keys {
+		if jwk.Alg == "HS256" {
+			t.Error("expected HMAC secret not to be published")
+		}
+	}
+}
+
+func TestLoadKeyringErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadKeyring(dir); err == nil {
+		t.Error("expected empty directory to be rejected")
+	}
+
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	writePublicKey(t, dir, "public-only", edKey.Public())
+	if _, err := LoadKeyring(dir); err == nil || !strings.Contains(err.Error(), "no private keys") {
+		t.Errorf("expected missing private key error, got %v", err)
+	}
+
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	writePrivateKey(t, dir, "weak", weak)
+	if _, err := LoadKeyring(dir); err == nil {
+		t.Error("expected 1024 bit RSA key to be rejected")
+	}
+}
+
+func TestJWKPublicKey(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	writePrivateKey(t, dir, "ed", edKey)
+	writePrivateKey(t, dir, "rsa", rsaKey)
+	keys, err := LoadKeyring(dir)
+	if err != nil {
+		t.Fatalf("LoadKeyring failed: %v", err)
+	}
+
+	// Published keys decode back to the keys they came from
+	for _, jwk := range keys.JWKS().Keys {
+		public, err := jwk.PublicKey()
+		if err != nil {
+			t.Fatalf("PublicKey failed for %q: %v", jwk.Kid, err)
+		}
+		var expected crypto.PublicKey = edKey.Public()
+		if jwk.Kid == "rsa" {
+			expected = rsaKey.Public()
+		}
+		if !expected.(interface{ Equal(crypto.PublicKey) bool }).Equal(public) {
+			t.Errorf("key %q didn't round trip", jwk.Kid)
+		}
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	point, _ := ecKey.PublicKey.Bytes()
+	ecJWK := JWK{
+		Kty: "EC",
+		Kid: "ec",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(point[1:33]),
+		Y:   base64.RawURLEncoding.EncodeToString(point[33:]),
+	}
+	public, err := ecJWK.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey failed for EC key: %v", err)
+	}
+	if !ecKey.PublicKey.Equal(public) {
+		t.Error("EC key didn't round trip")
+	}
+
+	// A point off the curve is rejected
+	ecJWK.Y = ecJWK.X
+	if _, err := ecJWK.PublicKey(); err == nil {
+		t.Error("expected point off the curve to be rejected")
+	}
+	if _, err := (JWK{Kty: "oct", Kid: "secret"}).PublicKey(); err == nil {
+		t.Error("expected symmetric key to be rejected")
+	}
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PATPrefix starts every personal access token, so they can be told apart
+// from JWTs and spotted by secret scanners
+const PATPrefix = "chirpy_pat_"
+
+// Scopes a personal access token or an OAuth client can be granted.
+// Access tokens from a login carry every scope.
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeFollowsWrite = "follows:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+var scopes = []string{
+	ScopeChirpsRead,
+	ScopeChirpsWrite,
+	ScopeFollowsWrite,
+	ScopeProfileWrite,
+}
+
+// MakePAT returns a new personal access token
+func MakePAT() (string, error) {
+	token, err := MakeToken()
+	if err != nil {
+		return "", err
+	}
+	return PATPrefix + token, nil
+}
+
+// IsPAT reports whether a bearer token is a personal access token
+func IsPAT(token string) bool {
+	return strings.HasPrefix(token, PATPrefix)
+}
+
+// ParseScopes checks that every scope is known, returning them sorted and
+// without duplicates
+func ParseScopes(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	parsed := make([]string, 0, len(requested))
+	for _, scope := range requested {
+		if !slices.Contains(scopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q, expected one of %s", scope, strings.Join(scopes, ", "))
+		}
+		parsed = append(parsed, scope)
+	}
+	slices.Sort(parsed)
+	return slices.Compact(parsed), nil
+}
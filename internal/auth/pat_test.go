@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMakePAT(t *testing.T) {
+	token, err := MakePAT()
+	if err != nil {
+		t.Fatalf("MakePAT failed: %v", err)
+	}
+	if !IsPAT(token) {
+		t.Errorf("expected %q to be a personal access token", token)
+	}
+	if IsPAT("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Error("expected a jwt not to be a personal access token")
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	got, err := ParseScopes([]string{ScopeChirpsWrite, ScopeChirpsRead, ScopeChirpsWrite})
+	if err != nil {
+		t.Fatalf("ParseScopes failed: %v", err)
+	}
+	expected := []string{ScopeChirpsRead, ScopeChirpsWrite}
+	if !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	for _, invalid := range [][]string{nil, {"chirps:delete"}, {ScopeChirpsRead, ""}} {
+		if _, err := ParseScopes(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
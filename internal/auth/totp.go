@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"fmt"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	totpIssuer  = "Chirpy"
+	totpPeriod  = 30
+	totpSkew    = 1
+	qrCodeSize  = 256
+	mfaPurpose  = "mfa"
+	recoveryLen = 10
+)
+
+// TOTPKey is a new authenticator secret along with the ways of handing it
+// to an authenticator app
+type TOTPKey struct {
+	Secret string
+	URI    string
+	QRCode []byte
+}
+
+// GenerateTOTPKey makes a new TOTP secret for the account, with its
+// otpauth:// URI and that URI as a QR code PNG
+func GenerateTOTPKey(accountName string) (TOTPKey, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: accountName,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return TOTPKey{}, fmt.Errorf("unable to generate totp key: %v", err)
+	}
+
+	img, err := key.Image(qrCodeSize, qrCodeSize)
+	if err != nil {
+		return TOTPKey{}, fmt.Errorf("unable to render qr code: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return TOTPKey{}, fmt.Errorf("unable to encode qr code: %v", err)
+	}
+
+	return TOTPKey{Secret: key.Secret(), URI: key.URL(), QRCode: buf.Bytes()}, nil
+}
+
+// ValidateTOTP checks code against secret at time t, allowing for one
+// period of clock drift either way. Codes from a time step at or before
+// lastStep are rejected so a code can't be replayed, on success the step
+// the code belongs to is returned to be stored as the new lastStep.
+func ValidateTOTP(code, secret string, t time.Time, lastStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	current := t.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := hotp.GenerateCodeCustom(secret, uint64(step), hotp.ValidateOpts{
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(code), []byte(expected)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// MakeRecoveryCodes returns n single-use codes such as "k3v9q-x2m7a" for
+// signing in without an authenticator
+func MakeRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, recoveryLen*5/8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+		codes[i] = code[:recoveryLen/2] + "-" + code[recoveryLen/2:]
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode puts a recovery code in the form it was hashed in,
+// so codes are accepted whatever their case or grouping
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.Join(strings.Fields(code), ""))
+	code = strings.ReplaceAll(code, "-", "")
+	if len(code) != recoveryLen {
+		return code
+	}
+	return code[:recoveryLen/2] + "-" + code[recoveryLen/2:]
+}
+
+// MakeMFAToken makes a short-lived token proving the user got their
+// password right, to be exchanged for a session along with a second
+// factor. It is not an access token.
+func MakeMFAToken(userID uuid.UUID, keys *Keyring, expiresIn time.Duration) (string, error) {
+	return keys.sign(claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		Purpose: mfaPurpose,
+	})
+}
+
+// ValidateMFAToken validates a token from MakeMFAToken and returns the user
+// it was issued to
+func ValidateMFAToken(tokenString string, keys *Keyring) (uuid.UUID, error) {
+	var claims claims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, keys.verificationKey)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !token.Valid || claims.Purpose != mfaPurpose {
+		return uuid.Nil, fmt.Errorf("token is not an mfa token")
+	}
+	return uuid.Parse(claims.Subject)
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pquerna/otp/totp"
+)
+
+func TestGenerateTOTPKey(t *testing.T) {
+	key, err := GenerateTOTPKey("user@example.com")
+	if err != nil {
+		t.Fatalf("GenerateTOTPKey failed: %v", err)
+	}
+	if !strings.HasPrefix(key.URI, "otpauth://totp/Chirpy:user@example.com?") {
+		t.Errorf("unexpected uri %q", key.URI)
+	}
+	if !strings.Contains(key.URI, "secret="+key.Secret) {
+		t.Errorf("expected uri %q to hold the secret", key.URI)
+	}
+	if !bytes.HasPrefix(key.QRCode, []byte("\x89PNG")) {
+		t.Error("expected qr code to be a png")
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	key, err := GenerateTOTPKey("user@example.com")
+	if err != nil {
+		t.Fatalf("GenerateTOTPKey failed: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	code, err := totp.GenerateCode(key.Secret, now)
+	if err != nil {
+		t.Fatalf("GenerateCode failed: %v", err)
+	}
+
+	step, ok := ValidateTOTP(code, key.Secret, now, 0)
+	if !ok || step != now.Unix()/30 {
+		t.Fatalf("expected code to be valid at step %d, got %d %v", now.Unix()/30, step, ok)
+	}
+
+	// One period of drift is allowed, more isn't
+	if _, ok := ValidateTOTP(code, key.Secret, now.Add(30*time.Second), 0); !ok {
+		t.Error("expected code from the previous period to be valid")
+	}
+	if _, ok := ValidateTOTP(code, key.Secret, now.Add(90*time.Second), 0); ok {
+		t.Error("expected code from three periods ago to be rejected")
+	}
+
+	// A used step can't be replayed
+	if _, ok := ValidateTOTP(code, key.Secret, now, step); ok {
+		t.Error("expected replayed code to be rejected")
+	}
+
+	if _, ok := ValidateTOTP("000000", "not base32!", now, 0); ok {
+		t.Error("expected invalid secret to be rejected")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := MakeRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("MakeRecoveryCodes failed: %v", err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("unexpected code format %q", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+
+		typed := " " + strings.ToUpper(strings.ReplaceAll(code, "-", "")) + " "
+		if got := NormalizeRecoveryCode(typed); got != code {
+			t.Errorf("expected %q to normalize to %q, got %q", typed, code, got)
+		}
+	}
+}
+
+func TestMFAToken(t *testing.T) {
+	keys := NewHMACKeyring("testsecret")
+	userID := uuid.New()
+
+	token, err := MakeMFAToken(userID, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeMFAToken failed: %v", err)
+	}
+	got, err := ValidateMFAToken(token, keys)
+	if err != nil || got != userID {
+		t.Fatalf("expected mfa token for %v, got %v %v", userID, got, err)
+	}
+
+	// MFA tokens and access tokens can't stand in for each other
+	if _, err := ValidateJWT(token, keys); err == nil {
+		t.Error("expected mfa token to be rejected as an access token")
+	}
+	access, _ := MakeJWT(userID, keys, time.Minute)
+	if _, err := ValidateMFAToken(access, keys); err == nil {
+		t.Error("expected access token to be rejected as an mfa token")
+	}
+}
@@ -7,29 +7,81 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to, root_id, quote_of)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4,
+    $5
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	RootID    uuid.NullUUID
+	QuoteOf   uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.InReplyTo,
+		arg.RootID,
+		arg.QuoteOf,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.LikeCount,
+		&i.QuoteOf,
+		&i.RechirpOf,
+	)
+	return i, err
+}
+
+const createRechirp = `-- name: CreateRechirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, rechirp_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    $1,
+    $2
+)
+ON CONFLICT (user_id, rechirp_of) WHERE rechirp_of IS NOT NULL DO NOTHING
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of
+`
+
+type CreateRechirpParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.NullUUID
+}
+
+func (q *Queries) CreateRechirp(ctx context.Context, arg CreateRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createRechirp, arg.UserID, arg.RechirpOf)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,10 +89,53 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.LikeCount,
+		&i.QuoteOf,
+		&i.RechirpOf,
 	)
 	return i, err
 }
 
+const decrementChirpLikeCount = `-- name: DecrementChirpLikeCount :one
+UPDATE chirps
+SET like_count = GREATEST(like_count - 1, 0)
+WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of
+`
+
+func (q *Queries) DecrementChirpLikeCount(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, decrementChirpLikeCount, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.LikeCount,
+		&i.QuoteOf,
+		&i.RechirpOf,
+	)
+	return i, err
+}
+
+const decrementChirpReplyCount = `-- name: DecrementChirpReplyCount :exec
+UPDATE chirps
+SET reply_count = GREATEST(reply_count - 1, 0)
+WHERE id = $1
+`
+
+func (q *Queries) DecrementChirpReplyCount(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, decrementChirpReplyCount, id)
+	return err
+}
+
 const deleteChirp = `-- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id = $1
@@ -51,8 +146,38 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteRechirp = `-- name: DeleteRechirp :one
+DELETE FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of
+`
+
+type DeleteRechirpParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.NullUUID
+}
+
+func (q *Queries) DeleteRechirp(ctx context.Context, arg DeleteRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, deleteRechirp, arg.UserID, arg.RechirpOf)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.LikeCount,
+		&i.QuoteOf,
+		&i.RechirpOf,
+	)
+	return i, err
+}
+
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of FROM chirps
 WHERE $1 = chirps.id
 `
 
@@ -65,17 +190,601 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.LikeCount,
+		&i.QuoteOf,
+		&i.RechirpOf,
+	)
+	return i, err
+}
+
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id, parent.in_reply_to, parent.root_id, parent.reply_count, parent.like_count, parent.quote_of, parent.rechirp_of FROM chirps parent
+    JOIN chirps child ON child.in_reply_to = parent.id
+    WHERE child.id = $1
+    UNION ALL
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.in_reply_to, c.root_id, c.reply_count, c.like_count, c.quote_of, c.rechirp_of FROM chirps c
+    JOIN ancestors a ON c.id = a.in_reply_to
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of FROM ancestors
+ORDER BY created_at ASC, id ASC
+`
+
+func (q *Queries) GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.QuoteOf,
+			&i.RechirpOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpForUpdate = `-- name: GetChirpForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of FROM chirps
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.LikeCount,
+		&i.QuoteOf,
+		&i.RechirpOf,
+	)
+	return i, err
+}
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of FROM chirps
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.QuoteOf,
+			&i.RechirpOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRechirp = `-- name: GetRechirp :one
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2
+`
+
+type GetRechirpParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.NullUUID
+}
+
+func (q *Queries) GetRechirp(ctx context.Context, arg GetRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getRechirp, arg.UserID, arg.RechirpOf)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.LikeCount,
+		&i.QuoteOf,
+		&i.RechirpOf,
+	)
+	return i, err
+}
+
+const incrementChirpLikeCount = `-- name: IncrementChirpLikeCount :one
+UPDATE chirps
+SET like_count = like_count + 1
+WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of
+`
+
+func (q *Queries) IncrementChirpLikeCount(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, incrementChirpLikeCount, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.LikeCount,
+		&i.QuoteOf,
+		&i.RechirpOf,
 	)
 	return i, err
 }
 
-const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-ORDER BY created_at ASC
+const incrementChirpReplyCount = `-- name: IncrementChirpReplyCount :exec
+UPDATE chirps
+SET reply_count = reply_count + 1
+WHERE id = $1
+`
+
+func (q *Queries) IncrementChirpReplyCount(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, incrementChirpReplyCount, id)
+	return err
+}
+
+const listChirpDescendantsBackward = `-- name: ListChirpDescendantsBackward :many
+WITH RECURSIVE descendants AS (
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.in_reply_to, c.root_id, c.reply_count, c.like_count, c.quote_of, c.rechirp_of, 1 AS depth, ARRAY[
+        (lpad((CASE WHEN $1::boolean
+            THEN 9000000000000000000 - (extract(epoch FROM c.created_at) * 1000000)::bigint
+            ELSE (extract(epoch FROM c.created_at) * 1000000)::bigint
+        END)::text, 19, '0') || c.id::text) COLLATE "C"
+    ] AS path
+    FROM chirps c
+    WHERE c.in_reply_to = $2
+    UNION ALL
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.in_reply_to, c.root_id, c.reply_count, c.like_count, c.quote_of, c.rechirp_of, d.depth + 1, d.path || (
+        (lpad((CASE WHEN $1::boolean
+            THEN 9000000000000000000 - (extract(epoch FROM c.created_at) * 1000000)::bigint
+            ELSE (extract(epoch FROM c.created_at) * 1000000)::bigint
+        END)::text, 19, '0') || c.id::text) COLLATE "C"
+    )
+    FROM chirps c
+    JOIN descendants d ON c.in_reply_to = d.id
+    WHERE d.depth < $3
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of FROM descendants
+WHERE $4::uuid IS NULL
+    OR path < (SELECT path FROM descendants WHERE id = $4::uuid)
+ORDER BY path DESC
+LIMIT $5
+`
+
+type ListChirpDescendantsBackwardParams struct {
+	NewestFirst bool
+	ChirpID     uuid.UUID
+	MaxDepth    int32
+	CursorID    uuid.NullUUID
+	Limit       int32
+}
+
+func (q *Queries) ListChirpDescendantsBackward(ctx context.Context, arg ListChirpDescendantsBackwardParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpDescendantsBackward,
+		arg.NewestFirst,
+		arg.ChirpID,
+		arg.MaxDepth,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.QuoteOf,
+			&i.RechirpOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpDescendantsForward = `-- name: ListChirpDescendantsForward :many
+WITH RECURSIVE descendants AS (
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.in_reply_to, c.root_id, c.reply_count, c.like_count, c.quote_of, c.rechirp_of, 1 AS depth, ARRAY[
+        (lpad((CASE WHEN $1::boolean
+            THEN 9000000000000000000 - (extract(epoch FROM c.created_at) * 1000000)::bigint
+            ELSE (extract(epoch FROM c.created_at) * 1000000)::bigint
+        END)::text, 19, '0') || c.id::text) COLLATE "C"
+    ] AS path
+    FROM chirps c
+    WHERE c.in_reply_to = $2
+    UNION ALL
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.in_reply_to, c.root_id, c.reply_count, c.like_count, c.quote_of, c.rechirp_of, d.depth + 1, d.path || (
+        (lpad((CASE WHEN $1::boolean
+            THEN 9000000000000000000 - (extract(epoch FROM c.created_at) * 1000000)::bigint
+            ELSE (extract(epoch FROM c.created_at) * 1000000)::bigint
+        END)::text, 19, '0') || c.id::text) COLLATE "C"
+    )
+    FROM chirps c
+    JOIN descendants d ON c.in_reply_to = d.id
+    WHERE d.depth < $3
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of FROM descendants
+WHERE $4::uuid IS NULL
+    OR path > (SELECT path FROM descendants WHERE id = $4::uuid)
+ORDER BY path ASC
+LIMIT $5
+`
+
+type ListChirpDescendantsForwardParams struct {
+	NewestFirst bool
+	ChirpID     uuid.UUID
+	MaxDepth    int32
+	CursorID    uuid.NullUUID
+	Limit       int32
+}
+
+func (q *Queries) ListChirpDescendantsForward(ctx context.Context, arg ListChirpDescendantsForwardParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpDescendantsForward,
+		arg.NewestFirst,
+		arg.ChirpID,
+		arg.MaxDepth,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.QuoteOf,
+			&i.RechirpOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of FROM chirps
+WHERE ($1::uuid IS NULL OR user_id = $1::uuid)
+  AND ($2::timestamp IS NULL
+    OR (created_at, id) > ($2::timestamp, $3::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListChirpsAscParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.QuoteOf,
+			&i.RechirpOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of FROM chirps
+WHERE ($1::uuid IS NULL OR user_id = $1::uuid)
+  AND ($2::timestamp IS NULL
+    OR (created_at, id) < ($2::timestamp, $3::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type ListChirpsDescParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.QuoteOf,
+			&i.RechirpOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsTopAsc = `-- name: ListChirpsTopAsc :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of FROM chirps
+WHERE ($1::uuid IS NULL OR user_id = $1::uuid)
+  AND ($2::integer IS NULL
+    OR (like_count, created_at, id) > ($2::integer, $3::timestamp, $4::uuid))
+ORDER BY like_count ASC, created_at ASC, id ASC
+LIMIT $5
+`
+
+type ListChirpsTopAscParams struct {
+	AuthorID        uuid.NullUUID
+	CursorLikeCount sql.NullInt32
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsTopAsc(ctx context.Context, arg ListChirpsTopAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsTopAsc,
+		arg.AuthorID,
+		arg.CursorLikeCount,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.QuoteOf,
+			&i.RechirpOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsTopDesc = `-- name: ListChirpsTopDesc :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of FROM chirps
+WHERE ($1::uuid IS NULL OR user_id = $1::uuid)
+  AND ($2::integer IS NULL
+    OR (like_count, created_at, id) < ($2::integer, $3::timestamp, $4::uuid))
+ORDER BY like_count DESC, created_at DESC, id DESC
+LIMIT $5
+`
+
+type ListChirpsTopDescParams struct {
+	AuthorID        uuid.NullUUID
+	CursorLikeCount sql.NullInt32
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsTopDesc(ctx context.Context, arg ListChirpsTopDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsTopDesc,
+		arg.AuthorID,
+		arg.CursorLikeCount,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.QuoteOf,
+			&i.RechirpOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTimelineAsc = `-- name: ListTimelineAsc :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.root_id, chirps.reply_count, chirps.like_count, chirps.quote_of, chirps.rechirp_of FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = $1
+  AND ($2::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) > ($2::timestamp, $3::uuid))
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT $4
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+type ListTimelineAscParams struct {
+	UserID          uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListTimelineAsc(ctx context.Context, arg ListTimelineAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listTimelineAsc,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -89,6 +798,12 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.QuoteOf,
+			&i.RechirpOf,
 		); err != nil {
 			return nil, err
 		}
@@ -103,14 +818,30 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
-const getChripsByUserID = `-- name: GetChripsByUserID :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC
+const listTimelineDesc = `-- name: ListTimelineDesc :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.root_id, chirps.reply_count, chirps.like_count, chirps.quote_of, chirps.rechirp_of FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = $1
+  AND ($2::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < ($2::timestamp, $3::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $4
 `
 
-func (q *Queries) GetChripsByUserID(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChripsByUserID, userID)
+type ListTimelineDescParams struct {
+	UserID          uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListTimelineDesc(ctx context.Context, arg ListTimelineDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listTimelineDesc,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -124,6 +855,12 @@ func (q *Queries) GetChripsByUserID(ctx context.Context, userID uuid.UUID) ([]Ch
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.QuoteOf,
+			&i.RechirpOf,
 		); err != nil {
 			return nil, err
 		}
@@ -137,3 +874,34 @@ func (q *Queries) GetChripsByUserID(ctx context.Context, userID uuid.UUID) ([]Ch
 	}
 	return items, nil
 }
+
+const updateChirp = `-- name: UpdateChirp :one
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of
+`
+
+type UpdateChirpParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+func (q *Queries) UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirp, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.LikeCount,
+		&i.QuoteOf,
+		&i.RechirpOf,
+	)
+	return i, err
+}
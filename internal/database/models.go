@@ -12,27 +12,199 @@ import (
 )
 
 type Chirp struct {
-	ID        uuid.UUID
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Body       string
+	UserID     uuid.UUID
+	InReplyTo  uuid.NullUUID
+	RootID     uuid.NullUUID
+	ReplyCount int32
+	LikeCount  int32
+	QuoteOf    uuid.NullUUID
+	RechirpOf  uuid.NullUUID
+}
+
+type ChirpHashtag struct {
+	ChirpID  uuid.UUID
+	Tag      string
+	Position int32
+}
+
+type ChirpLike struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
 	CreatedAt time.Time
-	UpdatedAt time.Time
-	Body      string
+}
+
+type ChirpMention struct {
+	ChirpID    uuid.UUID
+	UserID     uuid.UUID
+	StartIndex int32
+	Length     int32
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Body       string
+	CreatedAt  time.Time
+	ReplacedAt time.Time
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
 	UserID    uuid.UUID
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
 }
 
-type RefreshToken struct {
-	Token     string
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type LoginFailure struct {
+	Scope        string
+	Identifier   string
+	Failures     int32
+	LastFailedAt time.Time
+}
+
+type MagicLinkToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	FamilyID      uuid.UUID
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris []string
+	CreatedAt    time.Time
+}
+
+type OauthDeviceCode struct {
+	DeviceCodeHash string
+	UserCode       string
+	ClientID       uuid.UUID
+	Scopes         []string
+	FamilyID       uuid.UUID
+	UserID         uuid.NullUUID
+	PollInterval   int32
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	LastPolledAt   sql.NullTime
+	ApprovedAt     sql.NullTime
+	DeniedAt       sql.NullTime
+	UsedAt         sql.NullTime
+}
+
+type OidcLoginState struct {
+	StateHash    string
+	Nonce        string
+	CodeVerifier string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	UserID    uuid.UUID
 	CreatedAt time.Time
-	UpdatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	Token      string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	FamilyID   uuid.UUID
+	ReplacedBy sql.NullString
+	UserAgent  string
+	Ip         string
+	LastUsedAt time.Time
+	ClientID   uuid.NullUUID
+	Scopes     []string
+}
+
+type RevokedAccessToken struct {
+	Jti       string
 	UserID    uuid.UUID
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	RevokedAt time.Time
+}
+
+type TotpCredential struct {
+	UserID       uuid.UUID
+	Secret       string
+	CreatedAt    time.Time
+	ConfirmedAt  sql.NullTime
+	LastUsedStep int64
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    sql.NullBool
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	HashedPassword  string
+	IsChirpyRed     sql.NullBool
+	Handle          sql.NullString
+	DisplayName     string
+	Bio             string
+	AvatarUrl       string
+	EmailVerifiedAt sql.NullTime
+}
+
+type UserIdentity struct {
+	Issuer    string
+	Subject   string
+	UserID    uuid.UUID
+	Email     string
+	CreatedAt time.Time
 }
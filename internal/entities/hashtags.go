@@ -0,0 +1,78 @@
+package entities
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const maxHashtagLength = 100
+
+// NormalizeHashtag folds a tag so differently cased or composed spellings
+// of the same tag compare equal. A leading '#' is dropped.
+func NormalizeHashtag(tag string) string {
+	tag = strings.TrimPrefix(tag, "#")
+	return norm.NFKC.String(cases.Fold().String(norm.NFKC.String(tag)))
+}
+
+// Hashtags returns the normalized #tags in body in the order they first
+// appear. Tags must start at a word boundary and contain at least one letter.
+func Hashtags(body string) []string {
+	tags := []string{}
+	seen := map[string]struct{}{}
+	for _, span := range scan(body, '#') {
+		tag := NormalizeHashtag(body[span.start:span.end])
+		if !strings.ContainsFunc(tag, unicode.IsLetter) || utf8.RuneCountInString(tag) > maxHashtagLength {
+			continue
+		}
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// span is the byte range of an entity in a chirp body, including its sigil
+type span struct {
+	start int
+	end   int
+}
+
+// scan finds every run of word characters in body that follows sigil at a
+// word boundary
+func scan(body string, sigil rune) []span {
+	var spans []span
+	prev := ' '
+	for i := 0; i < len(body); {
+		r, size := utf8.DecodeRuneInString(body[i:])
+		if r != sigil || isWordRune(prev) {
+			prev = r
+			i += size
+			continue
+		}
+
+		end := i + size
+		for end < len(body) {
+			next, nextSize := utf8.DecodeRuneInString(body[end:])
+			if !isWordRune(next) {
+				break
+			}
+			end += nextSize
+		}
+		if end > i+size {
+			spans = append(spans, span{start: i, end: end})
+		}
+		prev = r
+		i = end
+	}
+	return spans
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
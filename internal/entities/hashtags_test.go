@@ -0,0 +1,65 @@
+package entities
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHashtags(t *testing.T) {
+	cases := []struct {
+		name     string
+		body     string
+		expected []string
+	}{
+		{
+			name:     "no tags",
+			body:     "just a chirp",
+			expected: []string{},
+		},
+		{
+			name:     "tags in order of appearance",
+			body:     "#go is great #chirpy",
+			expected: []string{"go", "chirpy"},
+		},
+		{
+			name:     "case folded and deduplicated",
+			body:     "#Go #GO #go",
+			expected: []string{"go"},
+		},
+		{
+			name:     "unicode folded",
+			body:     "#Straße #STRASSE #ＷＩＤＥ",
+			expected: []string{"strasse", "wide"},
+		},
+		{
+			name:     "stops at punctuation",
+			body:     "love #golang, #sqlc!",
+			expected: []string{"golang", "sqlc"},
+		},
+		{
+			name:     "ignores numbers, anchors and bare signs",
+			body:     "issue #123 see page#anchor and # alone",
+			expected: []string{},
+		},
+		{
+			name:     "underscores and digits",
+			body:     "#go_1_25",
+			expected: []string{"go_1_25"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tags := Hashtags(tc.body)
+			if !slices.Equal(tags, tc.expected) {
+				t.Errorf("expected tags %q, got %q", tc.expected, tags)
+			}
+		})
+	}
+}
+
+func TestNormalizeHashtag(t *testing.T) {
+	if got := NormalizeHashtag("#GoLang"); got != "golang" {
+		t.Errorf("expected %q, got %q", "golang", got)
+	}
+}
@@ -0,0 +1,81 @@
+package entities
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var handlePattern = regexp.MustCompile(`^[a-zA-Z0-9_]{1,15}$`)
+
+// ValidHandle reports whether handle is 1-15 ASCII letters, digits or
+// underscores
+func ValidHandle(handle string) bool {
+	return handlePattern.MatchString(handle)
+}
+
+// reservedHandles can't be registered because they collide with routes
+// or could be mistaken for staff accounts
+var reservedHandles = map[string]struct{}{
+	"about":     {},
+	"admin":     {},
+	"api":       {},
+	"chirpy":    {},
+	"help":      {},
+	"login":     {},
+	"logout":    {},
+	"me":        {},
+	"moderator": {},
+	"null":      {},
+	"root":      {},
+	"security":  {},
+	"settings":  {},
+	"signup":    {},
+	"staff":     {},
+	"support":   {},
+	"system":    {},
+}
+
+// ReservedHandle reports whether handle is kept back from users. Handles
+// are compared case-insensitively and names containing "chirpy" are
+// reserved too.
+func ReservedHandle(handle string) bool {
+	handle = NormalizeHandle(handle)
+	if _, ok := reservedHandles[handle]; ok {
+		return true
+	}
+	return strings.Contains(handle, "chirpy")
+}
+
+// NormalizeHandle returns the canonical lowercase spelling of a handle. A
+// leading '@' is dropped.
+func NormalizeHandle(handle string) string {
+	return strings.ToLower(strings.TrimPrefix(handle, "@"))
+}
+
+// Mention is an @handle in a chirp body. Offset and Length count Unicode
+// code points and include the '@'.
+type Mention struct {
+	Handle string
+	Offset int
+	Length int
+}
+
+// Mentions returns every @handle in body in the order they appear. Handles
+// are normalized and must start at a word boundary, so email addresses are
+// not mentions.
+func Mentions(body string) []Mention {
+	mentions := []Mention{}
+	for _, span := range scan(body, '@') {
+		handle := body[span.start+1 : span.end]
+		if !ValidHandle(handle) {
+			continue
+		}
+		mentions = append(mentions, Mention{
+			Handle: NormalizeHandle(handle),
+			Offset: utf8.RuneCountInString(body[:span.start]),
+			Length: utf8.RuneCountInString(body[span.start:span.end]),
+		})
+	}
+	return mentions
+}
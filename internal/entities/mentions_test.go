@@ -0,0 +1,75 @@
+package entities
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMentions(t *testing.T) {
+	cases := []struct {
+		name     string
+		body     string
+		expected []Mention
+	}{
+		{
+			name:     "no mentions",
+			body:     "just a chirp",
+			expected: []Mention{},
+		},
+		{
+			name: "offsets in code points",
+			body: "héllo @Alice and @bob_2",
+			expected: []Mention{
+				{Handle: "alice", Offset: 6, Length: 6},
+				{Handle: "bob_2", Offset: 17, Length: 6},
+			},
+		},
+		{
+			name: "stops at punctuation",
+			body: "thanks @carol!",
+			expected: []Mention{
+				{Handle: "carol", Offset: 7, Length: 6},
+			},
+		},
+		{
+			name:     "ignores emails and invalid handles",
+			body:     "mail me@example.com or @waytoolonghandle_123 or @",
+			expected: []Mention{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mentions := Mentions(tc.body)
+			if !slices.Equal(mentions, tc.expected) {
+				t.Errorf("expected mentions %+v, got %+v", tc.expected, mentions)
+			}
+		})
+	}
+}
+
+func TestValidHandle(t *testing.T) {
+	for _, handle := range []string{"a", "bob_2", "ABCDEFGHIJKLMNO"} {
+		if !ValidHandle(handle) {
+			t.Errorf("expected %q to be valid", handle)
+		}
+	}
+	for _, handle := range []string{"", "has space", "dash-ed", "ABCDEFGHIJKLMNOP", "émile"} {
+		if ValidHandle(handle) {
+			t.Errorf("expected %q to be invalid", handle)
+		}
+	}
+}
+
+func TestReservedHandle(t *testing.T) {
+	for _, handle := range []string{"me", "Admin", "@support", "ChirpyTeam"} {
+		if !ReservedHandle(handle) {
+			t.Errorf("expected %q to be reserved", handle)
+		}
+	}
+	for _, handle := range []string{"alice", "mega", "administrator_"} {
+		if ReservedHandle(handle) {
+			t.Errorf("expected %q not to be reserved", handle)
+		}
+	}
+}
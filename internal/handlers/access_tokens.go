@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/evanwiseman/chirpy/internal/models"
+	"github.com/google/uuid"
+)
+
+const (
+	maxTokenNameLength     = 100
+	maxTokenLifetimeInDays = 365
+)
+
+func (cfg *APIConfig) HandlerCreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't get bearer token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token, only a login can create tokens so a leaked
+	// personal access token can't be used to mint more
+	userID, err := auth.ValidateJWT(token, cfg.Keys)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't validate jwt: %v"}`, err)
+		return
+	}
+
+	// Decode the body into params
+	decoder := json.NewDecoder(r.Body)
+	params := struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays *int     `json:"expires_in_days"`
+	}{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid format: %v"}`, err)
+		return
+	}
+
+	// Validate the params, tokens without an expiry last until deleted
+	name := strings.TrimSpace(params.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxTokenNameLength {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "name must be 1-%d characters"}`, maxTokenNameLength)
+		return
+	}
+	scopes, err := auth.ParseScopes(params.Scopes)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid scopes: %v"}`, err)
+		return
+	}
+	var expiresAt sql.NullTime
+	if params.ExpiresInDays != nil {
+		days := *params.ExpiresInDays
+		if days < 1 || days > maxTokenLifetimeInDays {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"error": "expires_in_days must be 1-%d"}`, maxTokenLifetimeInDays)
+			return
+		}
+		expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, days), Valid: true}
+	}
+
+	// Generate the token, only its hash is stored
+	pat, err := auth.MakePAT()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "couldn't generate token: %v"}`, err)
+		return
+	}
+	dbToken, err := cfg.DB.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: auth.HashToken(pat),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "couldn't create token in database: %v"}`, err)
+		return
+	}
+
+	// Pack response
+	data, err := json.Marshal(models.FormatPersonalAccessToken(dbToken, pat))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(data)
+}
+
+func (cfg *APIConfig) HandlerGetAccessTokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't get bearer token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	userID, err := auth.ValidateJWT(token, cfg.Keys)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't validate jwt: %v"}`, err)
+		return
+	}
+
+	// Get the tokens
+	dbTokens, err := cfg.DB.ListPersonalAccessTokens(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to get tokens: %v"}`, err)
+		return
+	}
+
+	// Format a response
+	tokens := []models.PersonalAccessToken{}
+	for _, dbToken := range dbTokens {
+		tokens = append(tokens, models.FormatPersonalAccessToken(dbToken, ""))
+	}
+
+	// Pack response
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (cfg *APIConfig) HandlerDeleteAccessToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't get bearer token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	userID, err := auth.ValidateJWT(token, cfg.Keys)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't validate jwt: %v"}`, err)
+		return
+	}
+
+	// Parse the token ID
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid tokenID: %v"}`, err)
+		return
+	}
+
+	// Delete the token, other users' tokens are reported as not found
+	rows, err := cfg.DB.DeletePersonalAccessToken(r.Context(), database.DeletePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to delete token: %v"}`, err)
+		return
+	}
+	if rows == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "no token with id '%v'"}`, tokenID)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,19 +1,73 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"net"
 	"net/http"
+	"slices"
+	"strconv"
 	"sync/atomic"
+	"time"
 
+	"github.com/evanwiseman/chirpy/internal/auth"
 	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/evanwiseman/chirpy/internal/mail"
+	"github.com/evanwiseman/chirpy/internal/oidc"
+	"github.com/evanwiseman/chirpy/internal/passwords"
+	"github.com/evanwiseman/chirpy/internal/revocation"
+	"github.com/evanwiseman/chirpy/internal/throttle"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const mailTimeout = 30 * time.Second
+
 type APIConfig struct {
 	DB             *database.Queries
+	Conn           *sql.DB
 	FileServerHits atomic.Int32
 	Platform       string
-	JWTSecret      string
+	Keys           *auth.Keyring
+	RevokedTokens  *revocation.Store
+	Mailer         mail.Mailer
+	LoginLimiter   *throttle.Limiter
+	MailLimiter    *throttle.Limiter
+	CodeLimiter    *throttle.Limiter
+	OIDC           *oidc.Provider
+	PasswordPolicy passwords.Policy
 	PolkaKey       string
+	AdminKey       string
+
+	// AppURL is the address of the web app, which links in emails open
+	AppURL string
+
+	// RequireVerifiedEmail stops users posting chirps until they have
+	// confirmed their email
+	RequireVerifiedEmail bool
+}
+
+// HandlerJWKS publishes the public keys access tokens can be verified with
+func (cfg *APIConfig) HandlerJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Pack response
+	data, err := json.Marshal(cfg.Keys.JWKS())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	// Let verifiers cache the keys, rotated keys stay published long enough
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
 }
 
 func HandlerHealthz(w http.ResponseWriter, r *http.Request) {
@@ -21,3 +75,113 @@ func HandlerHealthz(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "OK")
 }
+
+// viewerID returns the user making the request, or uuid.Nil when the request
+// is anonymous or its access token is invalid
+func (cfg *APIConfig) viewerID(r *http.Request) uuid.UUID {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil
+	}
+	userID, err := cfg.authenticate(r.Context(), token, auth.ScopeChirpsRead)
+	if err != nil {
+		return uuid.Nil
+	}
+	return userID
+}
+
+// errInsufficientScope is returned by authenticate when a personal access
+// token or an OAuth client wasn't granted the scope an endpoint needs
+var errInsufficientScope = errors.New("token is missing the required scope")
+
+// authenticate validates a bearer token and returns the user it belongs
+// to. Access tokens from a login may do anything, personal access tokens
+// and access tokens issued to OAuth clients must have been granted scope.
+func (cfg *APIConfig) authenticate(ctx context.Context, token, scope string) (uuid.UUID, error) {
+	if !auth.IsPAT(token) {
+		accessToken, err := auth.ParseAccessToken(token, cfg.Keys)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if accessToken.ClientID != uuid.Nil && !slices.Contains(accessToken.Scopes, scope) {
+			return uuid.Nil, fmt.Errorf("%w %s", errInsufficientScope, scope)
+		}
+		return accessToken.UserID, nil
+	}
+
+	pat, err := cfg.DB.GetPersonalAccessTokenByHash(ctx, auth.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, fmt.Errorf("unknown personal access token")
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if pat.ExpiresAt.Valid && time.Now().After(pat.ExpiresAt.Time) {
+		return uuid.Nil, fmt.Errorf("personal access token has expired")
+	}
+	if !slices.Contains(pat.Scopes, scope) {
+		return uuid.Nil, fmt.Errorf("%w %s", errInsufficientScope, scope)
+	}
+
+	err = cfg.DB.TouchPersonalAccessToken(ctx, pat.ID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return pat.UserID, nil
+}
+
+// authStatus is the status to respond with when authenticate fails
+func authStatus(err error) int {
+	if errors.Is(err, errInsufficientScope) {
+		return http.StatusForbidden
+	}
+	return http.StatusUnauthorized
+}
+
+// isUniqueViolation reports whether err is postgres rejecting a duplicate
+// value in a unique column
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// clientIP returns the address of the client that sent r
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// allowMail holds off repeated requests to email the account with email,
+// or from the client's address, answering the request itself when it is
+// held off. Emails are counted whether or not an account uses them.
+func (cfg *APIConfig) allowMail(w http.ResponseWriter, r *http.Request, email string) bool {
+	retryAt, err := cfg.MailLimiter.Attempt(r.Context(), email, clientIP(r))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to check email requests: %v"}`, err)
+		return false
+	}
+	if !retryAt.IsZero() {
+		seconds := int(math.Ceil(time.Until(retryAt).Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintf(w, `{"error": "too many emails requested, try again later"}`)
+		return false
+	}
+	return true
+}
+
+// sendMail delivers msg in the background so responses don't reveal, by
+// how long they take, whether an email was sent
+func (cfg *APIConfig) sendMail(msg mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+		if err := cfg.Mailer.Send(ctx, msg); err != nil {
+			log.Printf("unable to send %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
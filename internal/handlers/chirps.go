@@ -1,18 +1,37 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"slices"
 	"strings"
 
 	"github.com/evanwiseman/chirpy/internal/auth"
 	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/evanwiseman/chirpy/internal/entities"
 	"github.com/evanwiseman/chirpy/internal/models"
+	"github.com/evanwiseman/chirpy/internal/pagination"
 	"github.com/google/uuid"
 )
 
+// getOriginalChirp returns the chirp with id, or the chirp it rechirps, so
+// replies, quotes and likes land on the chirp that was written instead of
+// on a rechirp that can be undone
+func (cfg *APIConfig) getOriginalChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	dbChirp, err := cfg.DB.GetChirp(ctx, id)
+	if err == nil && dbChirp.RechirpOf.Valid {
+		dbChirp, err = cfg.DB.GetChirp(ctx, dbChirp.RechirpOf.UUID)
+	}
+	return dbChirp, err
+}
+
+// threadDepth is how many levels of replies a thread includes, deeper ones
+// are fetched from the thread of the deepest reply shown
+const threadDepth = 10
+
 func cleanChirpBody(s string) string {
 	words := strings.Fields(s)
 
@@ -30,6 +49,186 @@ func cleanChirpBody(s string) string {
 	return strings.Join(words, " ")
 }
 
+// chirpKey is the keyset position of a chirp for pagination
+func chirpKey(c database.Chirp) pagination.Cursor {
+	return pagination.Cursor{CreatedAt: c.CreatedAt, ID: c.ID}
+}
+
+// chirpTopKey is the keyset position of a chirp when sorting by likes
+func chirpTopKey(c database.Chirp) pagination.Cursor {
+	return pagination.Cursor{Score: int64(c.LikeCount), CreatedAt: c.CreatedAt, ID: c.ID}
+}
+
+// saveChirpEntities replaces the hashtags and mentions indexed for a chirp
+// with the ones in its body. Mentions of unknown handles are dropped.
+func saveChirpEntities(ctx context.Context, q *database.Queries, dbChirp database.Chirp) error {
+	err := q.DeleteChirpHashtags(ctx, dbChirp.ID)
+	if err != nil {
+		return fmt.Errorf("unable to clear hashtags: %v", err)
+	}
+	err = q.DeleteChirpMentions(ctx, dbChirp.ID)
+	if err != nil {
+		return fmt.Errorf("unable to clear mentions: %v", err)
+	}
+
+	// Index the hashtags
+	tags := entities.Hashtags(dbChirp.Body)
+	if len(tags) > 0 {
+		err = q.CreateChirpHashtags(ctx, database.CreateChirpHashtagsParams{
+			ChirpID: dbChirp.ID,
+			Tags:    tags,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to save hashtags: %v", err)
+		}
+	}
+
+	// Resolve the mentions to users
+	mentions := entities.Mentions(dbChirp.Body)
+	if len(mentions) == 0 {
+		return nil
+	}
+	handles := make([]string, 0, len(mentions))
+	for _, mention := range mentions {
+		handles = append(handles, mention.Handle)
+	}
+	dbUsers, err := q.GetUsersByHandles(ctx, handles)
+	if err != nil {
+		return fmt.Errorf("unable to resolve mentions: %v", err)
+	}
+	userIDs := make(map[string]uuid.UUID, len(dbUsers))
+	for _, dbUser := range dbUsers {
+		userIDs[dbUser.Handle.String] = dbUser.ID
+	}
+
+	params := database.CreateChirpMentionsParams{ChirpID: dbChirp.ID}
+	for _, mention := range mentions {
+		userID, ok := userIDs[mention.Handle]
+		if !ok {
+			continue
+		}
+		params.UserIds = append(params.UserIds, userID)
+		params.StartIndexes = append(params.StartIndexes, int32(mention.Offset))
+		params.Lengths = append(params.Lengths, int32(mention.Length))
+	}
+	if len(params.UserIds) == 0 {
+		return nil
+	}
+	err = q.CreateChirpMentions(ctx, params)
+	if err != nil {
+		return fmt.Errorf("unable to save mentions: %v", err)
+	}
+	return nil
+}
+
+// formatChirps formats chirps as seen by viewerID, which is uuid.Nil for
+// anonymous requests
+func (cfg *APIConfig) formatChirps(ctx context.Context, viewerID uuid.UUID, dbChirps []database.Chirp) ([]models.Chirp, error) {
+	// Look up the chirps being quoted or rechirped
+	var relatedIDs []uuid.UUID
+	for _, dbChirp := range dbChirps {
+		if dbChirp.QuoteOf.Valid {
+			relatedIDs = append(relatedIDs, dbChirp.QuoteOf.UUID)
+		}
+		if dbChirp.RechirpOf.Valid {
+			relatedIDs = append(relatedIDs, dbChirp.RechirpOf.UUID)
+		}
+	}
+	related := make(map[uuid.UUID]database.Chirp, len(relatedIDs))
+	if len(relatedIDs) > 0 {
+		dbRelated, err := cfg.DB.GetChirpsByIDs(ctx, relatedIDs)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get referenced chirps: %v", err)
+		}
+		for _, dbChirp := range dbRelated {
+			related[dbChirp.ID] = dbChirp
+		}
+	}
+
+	chirps := make([]models.Chirp, 0, len(dbChirps))
+	for _, dbChirp := range dbChirps {
+		chirps = append(chirps, models.FormatChirp(dbChirp, related))
+	}
+	if len(chirps) == 0 {
+		return chirps, nil
+	}
+
+	// Collect every chirp being shown, including embedded ones
+	all := make([]*models.Chirp, 0, len(chirps)+len(related))
+	for i := range chirps {
+		all = append(all, &chirps[i])
+		for _, ref := range []*models.ChirpRef{chirps[i].QuoteOf, chirps[i].RechirpOf} {
+			if ref != nil && ref.Chirp != nil {
+				all = append(all, ref.Chirp)
+			}
+		}
+	}
+	chirpIDs := make([]uuid.UUID, 0, len(all))
+	for _, chirp := range all {
+		chirpIDs = append(chirpIDs, chirp.ID)
+	}
+
+	// Attach the hashtags
+	dbHashtags, err := cfg.DB.GetChirpHashtags(ctx, chirpIDs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get hashtags: %v", err)
+	}
+	hashtags := make(map[uuid.UUID][]string, len(dbHashtags))
+	for _, dbHashtag := range dbHashtags {
+		hashtags[dbHashtag.ChirpID] = append(hashtags[dbHashtag.ChirpID], dbHashtag.Tag)
+	}
+	for _, chirp := range all {
+		if tags, ok := hashtags[chirp.ID]; ok {
+			chirp.Hashtags = tags
+		}
+	}
+
+	// Attach the mentions
+	dbMentions, err := cfg.DB.GetChirpMentions(ctx, chirpIDs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get mentions: %v", err)
+	}
+	mentions := make(map[uuid.UUID][]models.Mention, len(dbMentions))
+	for _, dbMention := range dbMentions {
+		mentions[dbMention.ChirpID] = append(mentions[dbMention.ChirpID], models.FormatMention(dbMention))
+	}
+	for _, chirp := range all {
+		if m, ok := mentions[chirp.ID]; ok {
+			chirp.Mentions = m
+		}
+	}
+
+	if viewerID == uuid.Nil {
+		return chirps, nil
+	}
+
+	// Mark the chirps the viewer likes
+	likedIDs, err := cfg.DB.GetLikedChirpIDs(ctx, database.GetLikedChirpIDsParams{
+		UserID:   viewerID,
+		ChirpIds: chirpIDs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get liked chirps: %v", err)
+	}
+	liked := make(map[uuid.UUID]bool, len(likedIDs))
+	for _, id := range likedIDs {
+		liked[id] = true
+	}
+	for _, chirp := range all {
+		chirp.LikedByMe = liked[chirp.ID]
+	}
+	return chirps, nil
+}
+
+// formatChirp formats a single chirp as seen by viewerID
+func (cfg *APIConfig) formatChirp(ctx context.Context, viewerID uuid.UUID, dbChirp database.Chirp) (models.Chirp, error) {
+	chirps, err := cfg.formatChirps(ctx, viewerID, []database.Chirp{dbChirp})
+	if err != nil {
+		return models.Chirp{}, err
+	}
+	return chirps[0], nil
+}
+
 // Validates
 func validateChirpBody(body string) error {
 	if len(body) > 140 {
@@ -44,7 +243,9 @@ func (cfg *APIConfig) HandlerPostChirps(w http.ResponseWriter, r *http.Request)
 	// Decode the json from the request
 	decoder := json.NewDecoder(r.Body)
 	params := struct {
-		Body string `json:"body"`
+		Body      string     `json:"body"`
+		InReplyTo *uuid.UUID `json:"in_reply_to"`
+		QuoteOf   *uuid.UUID `json:"quote_of"`
 	}{}
 	err := decoder.Decode(&params)
 	if err != nil {
@@ -62,13 +263,26 @@ func (cfg *APIConfig) HandlerPostChirps(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Validate the access token
-	userID, err := auth.ValidateJWT(token, cfg.JWTSecret)
+	userID, err := cfg.authenticate(r.Context(), token, auth.ScopeChirpsWrite)
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
+		w.WriteHeader(authStatus(err))
 		fmt.Fprintf(w, `{"error": "couldn't validate jwt: %v"}`, err)
 		return
 	}
 
+	// Unverified users can't post when verified emails are required
+	allowed, err := cfg.canPost(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to get user: %v"}`, err)
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, `{"error": "verify your email before posting chirps"}`)
+		return
+	}
+
 	// Validate the chirp
 	err = validateChirpBody(params.Body)
 	if err != nil {
@@ -77,10 +291,54 @@ func (cfg *APIConfig) HandlerPostChirps(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Find the chirp being replied to and the root of its thread, replying
+	// to a rechirp replies to the original
+	var inReplyTo, rootID uuid.NullUUID
+	if params.InReplyTo != nil {
+		parent, err := cfg.getOriginalChirp(r.Context(), *params.InReplyTo)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"error": "unable to get chirp '%v' to reply to: %v"}`, *params.InReplyTo, err)
+			return
+		}
+		inReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		rootID = parent.RootID
+		// A parent replying to nothing is a root, while a reply whose root was
+		// deleted leaves its thread without one
+		if !rootID.Valid && !parent.InReplyTo.Valid {
+			rootID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		}
+	}
+
+	// Find the chirp being quoted, quoting a rechirp quotes the original
+	var quoteOf uuid.NullUUID
+	if params.QuoteOf != nil {
+		quoted, err := cfg.getOriginalChirp(r.Context(), *params.QuoteOf)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"error": "unable to get chirp '%v' to quote: %v"}`, *params.QuoteOf, err)
+			return
+		}
+		quoteOf = uuid.NullUUID{UUID: quoted.ID, Valid: true}
+	}
+
+	// Create the chirp, its entities and bump the parent's reply count together
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to start transaction: %v"}`, err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
 	// Create the chrip in the database
-	dbChirp, err := cfg.DB.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   cleanChirpBody(params.Body), // provide a cleaned chirp
-		UserID: userID,
+	dbChirp, err := qtx.CreateChirp(r.Context(), database.CreateChirpParams{
+		Body:      cleanChirpBody(params.Body), // provide a cleaned chirp
+		UserID:    userID,
+		InReplyTo: inReplyTo,
+		RootID:    rootID,
+		QuoteOf:   quoteOf,
 	})
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -88,8 +346,37 @@ func (cfg *APIConfig) HandlerPostChirps(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Index the hashtags and mentions in the cleaned body
+	err = saveChirpEntities(r.Context(), qtx, dbChirp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to index chirp: %v"}`, err)
+		return
+	}
+
+	if inReplyTo.Valid {
+		err = qtx.IncrementChirpReplyCount(r.Context(), inReplyTo.UUID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "unable to update reply count: %v"}`, err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to commit transaction: %v"}`, err)
+		return
+	}
+
 	// Format the response
-	resp := models.FormatChirp(dbChirp)
+	resp, err := cfg.formatChirp(r.Context(), userID, dbChirp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to format chirp: %v"}`, err)
+		return
+	}
 
 	// Pack the data
 	data, err := json.Marshal(resp)
@@ -106,53 +393,82 @@ func (cfg *APIConfig) HandlerPostChirps(w http.ResponseWriter, r *http.Request)
 func (cfg *APIConfig) HandlerGetChirps(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	var (
-		dbChirps []database.Chirp
-		err      error
-	)
+	query := r.URL.Query()
+
+	// Parse the page size, sort and cursor
+	page, err := pagination.ParseQuery(query, pagination.SortAsc)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid page: %v"}`, err)
+		return
+	}
 
-	if r.URL.Query().Has("author_id") { // Query by user id
-		userID, err := uuid.Parse(r.URL.Query().Get("author_id"))
+	// Query by user id
+	var authorID uuid.NullUUID
+	if query.Has("author_id") {
+		userID, err := uuid.Parse(query.Get("author_id"))
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			fmt.Fprintf(w, `{"error": "unable to parse author id: %v"}`, err)
 			return
 		}
-		dbChirps, err = cfg.DB.GetChripsByUserID(r.Context(), userID)
-		if err != nil {
-			w.WriteHeader(http.StatusNotFound)
-			fmt.Fprintf(w, `{"error": "unable to find user %v: %v"}`, userID, err)
-			return
-		}
-	} else { // Get all chirps
-		dbChirps, err = cfg.DB.GetChirps(r.Context())
-		if err != nil {
-			w.WriteHeader(http.StatusNotFound)
-			fmt.Fprintf(w, `{"error": "unable to get chirps: %v"}`, err)
-			return
-		}
+		authorID = uuid.NullUUID{UUID: userID, Valid: true}
 	}
 
-	// Filter in memory for sort dir asc or desc
-	if r.URL.Query().Has("sort") {
-		sort := r.URL.Query().Get("sort")
-		var direction int
-		switch sort {
-		case "asc":
-			direction = 1
-		case "desc":
-			direction = -1
-		default:
-			direction = 0
+	// Fetch one extra row to find out if there is another page
+	var dbChirps []database.Chirp
+	ascending := pagination.Ascending(page.Sort, page.Cursor)
+	key := chirpKey
+	if page.Sort == pagination.SortTop {
+		params := database.ListChirpsTopAscParams{
+			AuthorID: authorID,
+			Limit:    int32(page.Limit + 1),
 		}
-		slices.SortFunc(dbChirps, func(a database.Chirp, b database.Chirp) int {
-			return a.CreatedAt.Compare(b.CreatedAt) * direction
-		})
+		if page.Cursor != nil {
+			params.CursorLikeCount = sql.NullInt32{Int32: int32(page.Cursor.Score), Valid: true}
+			params.CursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+			params.CursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+		}
+		if ascending {
+			dbChirps, err = cfg.DB.ListChirpsTopAsc(r.Context(), params)
+		} else {
+			dbChirps, err = cfg.DB.ListChirpsTopDesc(r.Context(), database.ListChirpsTopDescParams(params))
+		}
+		key = chirpTopKey
+	} else {
+		params := database.ListChirpsAscParams{
+			AuthorID: authorID,
+			Limit:    int32(page.Limit + 1),
+		}
+		if page.Cursor != nil {
+			params.CursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+			params.CursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+		}
+		if ascending {
+			dbChirps, err = cfg.DB.ListChirpsAsc(r.Context(), params)
+		} else {
+			dbChirps, err = cfg.DB.ListChirpsDesc(r.Context(), database.ListChirpsDescParams(params))
+		}
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to get chirps: %v"}`, err)
+		return
 	}
+
+	dbChirps, next, prev := pagination.Paginate(dbChirps, page.Limit, page.Sort, page.Cursor, key)
+
 	// Format a response
-	var resp []models.Chirp
-	for _, dbChirp := range dbChirps {
-		resp = append(resp, models.FormatChirp(dbChirp))
+	chirps, err := cfg.formatChirps(r.Context(), cfg.viewerID(r), dbChirps)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to format chirps: %v"}`, err)
+		return
+	}
+	resp := models.Page[models.Chirp]{
+		Data: chirps,
+		Next: next,
+		Prev: prev,
 	}
 
 	// Pack response
@@ -163,6 +479,9 @@ func (cfg *APIConfig) HandlerGetChirps(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if link := pagination.LinkHeader(r.URL, next, prev); link != "" {
+		w.Header().Set("Link", link)
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Write(data)
 }
@@ -186,7 +505,12 @@ func (cfg *APIConfig) HandlerGetChripByID(w http.ResponseWriter, r *http.Request
 	}
 
 	// Format a response
-	resp := models.FormatChirp(dbChirp)
+	resp, err := cfg.formatChirp(r.Context(), cfg.viewerID(r), dbChirp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to format chirp: %v"}`, err)
+		return
+	}
 
 	// Pack data
 	data, err := json.Marshal(resp)
@@ -212,9 +536,9 @@ func (cfg *APIConfig) HandlerDeleteChirpByID(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Validate the access token
-	userID, err := auth.ValidateJWT(token, cfg.JWTSecret)
+	userID, err := cfg.authenticate(r.Context(), token, auth.ScopeChirpsWrite)
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
+		w.WriteHeader(authStatus(err))
 		fmt.Fprintf(w, `{"error": "invalid access token: %v"}`, err)
 		return
 	}
@@ -241,12 +565,576 @@ func (cfg *APIConfig) HandlerDeleteChirpByID(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Delete the chirp and drop the parent's reply count together
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to start transaction: %v"}`, err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
 	// Delete the chirp
-	err = cfg.DB.DeleteChirp(r.Context(), dbChirp.ID)
+	err = qtx.DeleteChirp(r.Context(), dbChirp.ID)
 	if err != nil {
 		w.WriteHeader(http.StatusNotFound)
 		fmt.Fprintf(w, `{"error": "chirp not found: %v"}`, err)
 		return
 	}
+
+	if dbChirp.InReplyTo.Valid {
+		err = qtx.DecrementChirpReplyCount(r.Context(), dbChirp.InReplyTo.UUID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "unable to update reply count: %v"}`, err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to commit transaction: %v"}`, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *APIConfig) HandlerPutChirpByID(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "malformed access token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	userID, err := cfg.authenticate(r.Context(), token, auth.ScopeChirpsWrite)
+	if err != nil {
+		w.WriteHeader(authStatus(err))
+		fmt.Fprintf(w, `{"error": "invalid access token: %v"}`, err)
+		return
+	}
+
+	// Unverified users can't edit chirps when verified emails are required
+	allowed, err := cfg.canPost(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to get user: %v"}`, err)
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, `{"error": "verify your email before editing chirps"}`)
+		return
+	}
+
+	// Get the chirp id
+	chirpIDStr := r.PathValue("chirpID")
+	chirpID, err := uuid.Parse(chirpIDStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid chirpID: %v"}`, err)
+		return
+	}
+
+	// Decode the json from the request
+	decoder := json.NewDecoder(r.Body)
+	params := struct {
+		Body string `json:"body"`
+	}{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid format: %v"}`, err)
+		return
+	}
+
+	// Validate the chirp
+	err = validateChirpBody(params.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid chirp: %v"}`, err)
+		return
+	}
+
+	// Save the revision and the edit together
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to start transaction: %v"}`, err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	// Lock the chirp so concurrent edits don't lose revisions
+	dbChirp, err := qtx.GetChirpForUpdate(r.Context(), chirpID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "unable to get chirp '%v': %v"}`, chirpID, err)
+		return
+	}
+
+	// Check that the requester is the author
+	if userID != dbChirp.UserID {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, `{"error": "forbidden, unable to edit chirp: requester is not owner"}`)
+		return
+	}
+
+	// Rechirps have no body of their own to edit
+	if dbChirp.RechirpOf.Valid {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "unable to edit chirp: rechirps can't be edited"}`)
+		return
+	}
+
+	// Keep the current body as a revision
+	_, err = qtx.CreateChirpRevision(r.Context(), database.CreateChirpRevisionParams{
+		ChirpID:   dbChirp.ID,
+		Body:      dbChirp.Body,
+		CreatedAt: dbChirp.UpdatedAt,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to save chirp revision: %v"}`, err)
+		return
+	}
+
+	// Update the chirp with a cleaned body
+	dbChirp, err = qtx.UpdateChirp(r.Context(), database.UpdateChirpParams{
+		ID:   dbChirp.ID,
+		Body: cleanChirpBody(params.Body),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to update chirp: %v"}`, err)
+		return
+	}
+
+	// Re-index the hashtags and mentions for the new body
+	err = saveChirpEntities(r.Context(), qtx, dbChirp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to index chirp: %v"}`, err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to commit transaction: %v"}`, err)
+		return
+	}
+
+	// Format a response
+	resp, err := cfg.formatChirp(r.Context(), userID, dbChirp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to format chirp: %v"}`, err)
+		return
+	}
+
+	// Pack data
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (cfg *APIConfig) HandlerGetChirpHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the chirp
+	chirpIDStr := r.PathValue("chirpID")
+	chirpID, err := uuid.Parse(chirpIDStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid chirpID: %v"}`, err)
+		return
+	}
+	dbChirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "unable to get chirp '%v': %v"}`, chirpID, err)
+		return
+	}
+
+	// Get the previous revisions, oldest first
+	dbRevisions, err := cfg.DB.GetChirpRevisions(r.Context(), dbChirp.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to get chirp history: %v"}`, err)
+		return
+	}
+
+	// Format a response
+	resp := []models.ChirpRevision{}
+	for _, dbRevision := range dbRevisions {
+		resp = append(resp, models.FormatChirpRevision(dbRevision))
+	}
+
+	// Pack data
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (cfg *APIConfig) HandlerGetChirpThread(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Parse the page size, sort and cursor for the replies
+	page, err := pagination.ParseQuery(r.URL.Query(), pagination.SortAsc)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid page: %v"}`, err)
+		return
+	}
+	if page.Sort == pagination.SortTop {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid page: replies can't be sorted by top"}`)
+		return
+	}
+
+	// Get the chirp
+	chirpIDStr := r.PathValue("chirpID")
+	chirpID, err := uuid.Parse(chirpIDStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid chirpID: %v"}`, err)
+		return
+	}
+	dbChirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "unable to get chirp '%v': %v"}`, chirpID, err)
+		return
+	}
+
+	// Walk up to the root of the thread
+	dbAncestors, err := cfg.DB.GetChirpAncestors(r.Context(), dbChirp.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to get chirp ancestors: %v"}`, err)
+		return
+	}
+
+	// Walk down the replies in tree order, each after the reply it answers,
+	// with siblings ordered by the sort. Fetch one extra row to find out if
+	// there is another page.
+	params := database.ListChirpDescendantsForwardParams{
+		NewestFirst: page.Sort == pagination.SortDesc,
+		ChirpID:     dbChirp.ID,
+		MaxDepth:    threadDepth,
+		Limit:       int32(page.Limit + 1),
+	}
+	if page.Cursor != nil {
+		params.CursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+	var dbReplies []database.Chirp
+	if page.Cursor == nil || page.Cursor.Direction == pagination.Next {
+		dbReplies, err = cfg.DB.ListChirpDescendantsForward(r.Context(), params)
+	} else {
+		dbReplies, err = cfg.DB.ListChirpDescendantsBackward(r.Context(), database.ListChirpDescendantsBackwardParams(params))
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to get chirp replies: %v"}`, err)
+		return
+	}
+
+	dbReplies, next, prev := pagination.Paginate(dbReplies, page.Limit, page.Sort, page.Cursor, chirpKey)
+
+	// Format the whole thread at once, the chirp then its ancestors then its replies
+	dbThread := append([]database.Chirp{dbChirp}, dbAncestors...)
+	dbThread = append(dbThread, dbReplies...)
+	thread, err := cfg.formatChirps(r.Context(), cfg.viewerID(r), dbThread)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to format chirps: %v"}`, err)
+		return
+	}
+	resp := models.ChirpThread{
+		Chirp:     thread[0],
+		Ancestors: thread[1 : 1+len(dbAncestors)],
+		Replies: models.Page[models.Chirp]{
+			Data: thread[1+len(dbAncestors):],
+			Next: next,
+			Prev: prev,
+		},
+	}
+
+	// Pack data
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	if link := pagination.LinkHeader(r.URL, next, prev); link != "" {
+		w.Header().Set("Link", link)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (cfg *APIConfig) HandlerPostChirpLike(w http.ResponseWriter, r *http.Request) {
+	cfg.setChirpLike(w, r, true)
+}
+
+func (cfg *APIConfig) HandlerDeleteChirpLike(w http.ResponseWriter, r *http.Request) {
+	cfg.setChirpLike(w, r, false)
+}
+
+// setChirpLike likes or unlikes the path chirp for the requester, keeping the
+// chirp's like count in step with its likes
+func (cfg *APIConfig) setChirpLike(w http.ResponseWriter, r *http.Request, like bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "malformed access token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	userID, err := cfg.authenticate(r.Context(), token, auth.ScopeChirpsWrite)
+	if err != nil {
+		w.WriteHeader(authStatus(err))
+		fmt.Fprintf(w, `{"error": "invalid access token: %v"}`, err)
+		return
+	}
+
+	// Get the chirp, liking a rechirp likes the original
+	chirpIDStr := r.PathValue("chirpID")
+	chirpID, err := uuid.Parse(chirpIDStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid chirpID: %v"}`, err)
+		return
+	}
+	dbChirp, err := cfg.getOriginalChirp(r.Context(), chirpID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "unable to get chirp '%v': %v"}`, chirpID, err)
+		return
+	}
+
+	// Change the like and the count together
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to start transaction: %v"}`, err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	// Only touch the count when the like actually changed so repeats are no-ops
+	var n int64
+	if like {
+		n, err = qtx.CreateChirpLike(r.Context(), database.CreateChirpLikeParams{
+			ChirpID: dbChirp.ID,
+			UserID:  userID,
+		})
+	} else {
+		n, err = qtx.DeleteChirpLike(r.Context(), database.DeleteChirpLikeParams{
+			ChirpID: dbChirp.ID,
+			UserID:  userID,
+		})
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to update like: %v"}`, err)
+		return
+	}
+	if n > 0 {
+		if like {
+			dbChirp, err = qtx.IncrementChirpLikeCount(r.Context(), dbChirp.ID)
+		} else {
+			dbChirp, err = qtx.DecrementChirpLikeCount(r.Context(), dbChirp.ID)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "unable to update like count: %v"}`, err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to commit transaction: %v"}`, err)
+		return
+	}
+
+	// Format a response
+	resp, err := cfg.formatChirp(r.Context(), userID, dbChirp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to format chirp: %v"}`, err)
+		return
+	}
+
+	// Pack data
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (cfg *APIConfig) HandlerPostRechirp(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "malformed access token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	userID, err := cfg.authenticate(r.Context(), token, auth.ScopeChirpsWrite)
+	if err != nil {
+		w.WriteHeader(authStatus(err))
+		fmt.Fprintf(w, `{"error": "invalid access token: %v"}`, err)
+		return
+	}
+
+	// Unverified users can't post when verified emails are required
+	allowed, err := cfg.canPost(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to get user: %v"}`, err)
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, `{"error": "verify your email before posting chirps"}`)
+		return
+	}
+
+	// Get the chirp, rechirping a rechirp rechirps the original
+	chirpIDStr := r.PathValue("chirpID")
+	chirpID, err := uuid.Parse(chirpIDStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid chirpID: %v"}`, err)
+		return
+	}
+	dbChirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "unable to get chirp '%v': %v"}`, chirpID, err)
+		return
+	}
+	rechirpOf := uuid.NullUUID{UUID: dbChirp.ID, Valid: true}
+	if dbChirp.RechirpOf.Valid {
+		rechirpOf = dbChirp.RechirpOf
+	}
+
+	// Create the rechirp, or return the existing one when rechirping twice
+	status := http.StatusCreated
+	dbRechirp, err := cfg.DB.CreateRechirp(r.Context(), database.CreateRechirpParams{
+		UserID:    userID,
+		RechirpOf: rechirpOf,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		status = http.StatusOK
+		dbRechirp, err = cfg.DB.GetRechirp(r.Context(), database.GetRechirpParams{
+			UserID:    userID,
+			RechirpOf: rechirpOf,
+		})
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to rechirp: %v"}`, err)
+		return
+	}
+
+	// Format the response
+	resp, err := cfg.formatChirp(r.Context(), userID, dbRechirp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to format chirp: %v"}`, err)
+		return
+	}
+
+	// Pack the data
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func (cfg *APIConfig) HandlerDeleteRechirp(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "malformed access token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	userID, err := cfg.authenticate(r.Context(), token, auth.ScopeChirpsWrite)
+	if err != nil {
+		w.WriteHeader(authStatus(err))
+		fmt.Fprintf(w, `{"error": "invalid access token: %v"}`, err)
+		return
+	}
+
+	// Get the chirp that was rechirped
+	chirpIDStr := r.PathValue("chirpID")
+	chirpID, err := uuid.Parse(chirpIDStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid chirpID: %v"}`, err)
+		return
+	}
+
+	// Delete the requester's rechirp of it
+	_, err = cfg.DB.DeleteRechirp(r.Context(), database.DeleteRechirpParams{
+		UserID:    userID,
+		RechirpOf: uuid.NullUUID{UUID: chirpID, Valid: true},
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "rechirp not found: %v"}`, err)
+		return
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/evanwiseman/chirpy/internal/models"
+	"github.com/evanwiseman/chirpy/internal/pagination"
+	"github.com/google/uuid"
+)
+
+func followerKey(f database.Follow) pagination.Cursor {
+	return pagination.Cursor{CreatedAt: f.CreatedAt, ID: f.FollowerID}
+}
+
+func followingKey(f database.Follow) pagination.Cursor {
+	return pagination.Cursor{CreatedAt: f.CreatedAt, ID: f.FolloweeID}
+}
+
+func (cfg *APIConfig) HandlerPostFollow(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "malformed access token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	userID, err := cfg.authenticate(r.Context(), token, auth.ScopeFollowsWrite)
+	if err != nil {
+		w.WriteHeader(authStatus(err))
+		fmt.Fprintf(w, `{"error": "invalid access token: %v"}`, err)
+		return
+	}
+
+	// Get the user to follow
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid userID: %v"}`, err)
+		return
+	}
+	if followeeID == userID {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "unable to follow yourself"}`)
+		return
+	}
+	_, err = cfg.DB.GetUser(r.Context(), followeeID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "unable to get user '%v': %v"}`, followeeID, err)
+		return
+	}
+
+	// Following twice is a no-op
+	err = cfg.DB.CreateFollow(r.Context(), database.CreateFollowParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to follow user: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *APIConfig) HandlerDeleteFollow(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "malformed access token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	userID, err := cfg.authenticate(r.Context(), token, auth.ScopeFollowsWrite)
+	if err != nil {
+		w.WriteHeader(authStatus(err))
+		fmt.Fprintf(w, `{"error": "invalid access token: %v"}`, err)
+		return
+	}
+
+	// Get the user to unfollow
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid userID: %v"}`, err)
+		return
+	}
+
+	n, err := cfg.DB.DeleteFollow(r.Context(), database.DeleteFollowParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to unfollow user: %v"}`, err)
+		return
+	}
+	if n == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "not following user '%v'"}`, followeeID)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *APIConfig) HandlerGetFollowers(w http.ResponseWriter, r *http.Request) {
+	cfg.listFollows(w, r, true)
+}
+
+func (cfg *APIConfig) HandlerGetFollowing(w http.ResponseWriter, r *http.Request) {
+	cfg.listFollows(w, r, false)
+}
+
+// listFollows writes a page of the users following the path user, or the
+// users the path user follows
+func (cfg *APIConfig) listFollows(w http.ResponseWriter, r *http.Request, followers bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Parse the page size, sort and cursor
+	page, err := pagination.ParseQuery(r.URL.Query(), pagination.SortDesc)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid page: %v"}`, err)
+		return
+	}
+	if page.Sort == pagination.SortTop {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid page: sort top is not supported here"}`)
+		return
+	}
+
+	// Get the user
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid userID: %v"}`, err)
+		return
+	}
+	_, err = cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "unable to get user '%v': %v"}`, userID, err)
+		return
+	}
+
+	// Fetch one extra row to find out if there is another page
+	params := database.ListFollowersAscParams{
+		UserID: userID,
+		Limit:  int32(page.Limit + 1),
+	}
+	if page.Cursor != nil {
+		params.CursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+	ascending := pagination.Ascending(page.Sort, page.Cursor)
+	var dbFollows []database.Follow
+	switch {
+	case followers && ascending:
+		dbFollows, err = cfg.DB.ListFollowersAsc(r.Context(), params)
+	case followers:
+		dbFollows, err = cfg.DB.ListFollowersDesc(r.Context(), database.ListFollowersDescParams(params))
+	case ascending:
+		dbFollows, err = cfg.DB.ListFollowingAsc(r.Context(), database.ListFollowingAscParams(params))
+	default:
+		dbFollows, err = cfg.DB.ListFollowingDesc(r.Context(), database.ListFollowingDescParams(params))
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to get follows: %v"}`, err)
+		return
+	}
+
+	key, format := followingKey, models.FormatFollowing
+	if followers {
+		key, format = followerKey, models.FormatFollower
+	}
+	dbFollows, next, prev := pagination.Paginate(dbFollows, page.Limit, page.Sort, page.Cursor, key)
+
+	// Format a response
+	resp := models.Page[models.Follow]{
+		Data: []models.Follow{},
+		Next: next,
+		Prev: prev,
+	}
+	for _, dbFollow := range dbFollows {
+		resp.Data = append(resp.Data, format(dbFollow))
+	}
+
+	// Pack response
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	if link := pagination.LinkHeader(r.URL, next, prev); link != "" {
+		w.Header().Set("Link", link)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (cfg *APIConfig) HandlerGetTimeline(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't get bearer token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	userID, err := cfg.authenticate(r.Context(), token, auth.ScopeChirpsRead)
+	if err != nil {
+		w.WriteHeader(authStatus(err))
+		fmt.Fprintf(w, `{"error": "couldn't validate jwt: %v"}`, err)
+		return
+	}
+
+	// Parse the page size, sort and cursor, newest first by default
+	page, err := pagination.ParseQuery(r.URL.Query(), pagination.SortDesc)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid page: %v"}`, err)
+		return
+	}
+	if page.Sort == pagination.SortTop {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid page: sort top is not supported here"}`)
+		return
+	}
+
+	// Fetch one extra row to find out if there is another page
+	params := database.ListTimelineAscParams{
+		UserID: userID,
+		Limit:  int32(page.Limit + 1),
+	}
+	if page.Cursor != nil {
+		params.CursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+	var dbChirps []database.Chirp
+	if pagination.Ascending(page.Sort, page.Cursor) {
+		dbChirps, err = cfg.DB.ListTimelineAsc(r.Context(), params)
+	} else {
+		dbChirps, err = cfg.DB.ListTimelineDesc(r.Context(), database.ListTimelineDescParams(params))
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to get timeline: %v"}`, err)
+		return
+	}
+
+	dbChirps, next, prev := pagination.Paginate(dbChirps, page.Limit, page.Sort, page.Cursor, chirpKey)
+
+	// Format a response
+	chirps, err := cfg.formatChirps(r.Context(), userID, dbChirps)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to format chirps: %v"}`, err)
+		return
+	}
+	resp := models.Page[models.Chirp]{
+		Data: chirps,
+		Next: next,
+		Prev: prev,
+	}
+
+	// Pack response
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	if link := pagination.LinkHeader(r.URL, next, prev); link != "" {
+		w.Header().Set("Link", link)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
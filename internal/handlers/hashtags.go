@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/evanwiseman/chirpy/internal/entities"
+	"github.com/evanwiseman/chirpy/internal/models"
+	"github.com/evanwiseman/chirpy/internal/pagination"
+	"github.com/google/uuid"
+)
+
+func (cfg *APIConfig) HandlerGetHashtagChirps(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Parse the page size, sort and cursor, newest first by default
+	page, err := pagination.ParseQuery(r.URL.Query(), pagination.SortDesc)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid page: %v"}`, err)
+		return
+	}
+	if page.Sort == pagination.SortTop {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid page: sort top is not supported here"}`)
+		return
+	}
+
+	// Normalize the tag the same way chirp bodies are indexed
+	tag := entities.NormalizeHashtag(r.PathValue("tag"))
+	if tag == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid tag"}`)
+		return
+	}
+
+	// Fetch one extra row to find out if there is another page
+	params := database.ListHashtagChirpsAscParams{
+		Tag:   tag,
+		Limit: int32(page.Limit + 1),
+	}
+	if page.Cursor != nil {
+		params.CursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+	var dbChirps []database.Chirp
+	if pagination.Ascending(page.Sort, page.Cursor) {
+		dbChirps, err = cfg.DB.ListHashtagChirpsAsc(r.Context(), params)
+	} else {
+		dbChirps, err = cfg.DB.ListHashtagChirpsDesc(r.Context(), database.ListHashtagChirpsDescParams(params))
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to get chirps for #%v: %v"}`, tag, err)
+		return
+	}
+
+	dbChirps, next, prev := pagination.Paginate(dbChirps, page.Limit, page.Sort, page.Cursor, chirpKey)
+
+	// Format a response
+	chirps, err := cfg.formatChirps(r.Context(), cfg.viewerID(r), dbChirps)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to format chirps: %v"}`, err)
+		return
+	}
+	resp := models.Page[models.Chirp]{
+		Data: chirps,
+		Next: next,
+		Prev: prev,
+	}
+
+	// Pack response
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	if link := pagination.LinkHeader(r.URL, next, prev); link != "" {
+		w.Header().Set("Link", link)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// dummyPasswordHash is checked against when a login names an unknown
+// email, so it takes as long as getting a real account's password wrong
+var dummyPasswordHash string
+
+// InitDummyPasswordHash makes the hash checked for unknown emails. Call it
+// once the password parameters are set and before serving, so the first
+// unknown email doesn't pay for hashing it.
+func InitDummyPasswordHash() error {
+	hash, err := auth.HashPassword("chirpy dummy password")
+	if err != nil {
+		return err
+	}
+	dummyPasswordHash = hash
+	return nil
+}
+
+// errInvalidCredentials is returned by checkPassword for an unknown email
+// or a wrong password, which aren't told apart so logins can't be used to
+// find accounts
+var errInvalidCredentials = errors.New("invalid email or password")
+
+// lockedOutError is returned by checkPassword while the account or address
+// is locked out
+type lockedOutError struct {
+	retryAt time.Time
+}
+
+func (e *lockedOutError) Error() string {
+	return "too many failed login attempts"
+}
+
+// checkPassword returns the user with email if password is theirs. Every
+// attempt counts against the account and the client's address until it
+// succeeds, and a success forgets the account's failures.
+func (cfg *APIConfig) checkPassword(r *http.Request, email, password string) (database.User, error) {
+	// Hold off repeated failures from the account or the address
+	ip := clientIP(r)
+	retryAt, err := cfg.LoginLimiter.Attempt(r.Context(), email, ip)
+	if err != nil {
+		return database.User{}, fmt.Errorf("unable to check login attempts: %w", err)
+	}
+	if !retryAt.IsZero() {
+		return database.User{}, &lockedOutError{retryAt: retryAt}
+	}
+
+	// Find the user, an unknown email is checked against a dummy hash so it
+	// fails the same way a wrong password does
+	user, err := cfg.DB.GetUserByEmail(r.Context(), email)
+	found := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, fmt.Errorf("unable to get user: %w", err)
+	}
+	hash := user.HashedPassword
+	if !found {
+		hash = dummyPasswordHash
+	}
+
+	ok, err := auth.CheckPasswordHash(password, hash)
+	if err != nil {
+		return database.User{}, fmt.Errorf("hashing failed: %w", err)
+	}
+	if !ok || !found {
+		return database.User{}, errInvalidCredentials
+	}
+	err = cfg.LoginLimiter.Succeed(r.Context(), email, ip)
+	if err != nil {
+		return database.User{}, fmt.Errorf("unable to record login attempt: %w", err)
+	}
+
+	// Upgrade hashes made with weaker parameters while the password is at
+	// hand. Logins go ahead even if this fails, it is tried again next time.
+	if auth.NeedsRehash(user.HashedPassword) {
+		hash, err := auth.HashPassword(password)
+		if err == nil {
+			err = cfg.DB.RehashUserPassword(r.Context(), database.RehashUserPasswordParams{
+				NewHashedPassword: hash,
+				ID:                user.ID,
+				HashedPassword:    user.HashedPassword,
+			})
+		}
+		if err != nil {
+			log.Printf("unable to rehash password: %v", err)
+		} else {
+			user.HashedPassword = hash
+		}
+	}
+	return user, nil
+}
+
+// writeLockedOut tells the client when it may try logging in again
+func writeLockedOut(w http.ResponseWriter, retryAt time.Time) {
+	seconds := int(math.Ceil(time.Until(retryAt).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	w.WriteHeader(http.StatusTooManyRequests)
+	fmt.Fprintf(w, `{"error": "too many failed login attempts, try again later"}`)
+}
+
+// isAdmin reports whether r carries the admin api key. Admin endpoints are
+// disabled when no key is configured.
+func (cfg *APIConfig) isAdmin(r *http.Request) bool {
+	if cfg.AdminKey == "" {
+		return false
+	}
+	apiKey, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.AdminKey)) == 1
+}
+
+func (cfg *APIConfig) HandlerUnlockUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Validate the api key
+	if !cfg.isAdmin(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "invalid api key"}`)
+		return
+	}
+
+	// Get the user
+	userIDStr := r.PathValue("userID")
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid userID: %v"}`, err)
+		return
+	}
+	user, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "unable to get user: %v"}`, err)
+		return
+	}
+
+	// Forget the account's failed logins
+	err = cfg.LoginLimiter.UnlockAccount(r.Context(), user.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to unlock user: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *APIConfig) HandlerUnlockIP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Validate the api key
+	if !cfg.isAdmin(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "invalid api key"}`)
+		return
+	}
+
+	// Parse the address
+	ip := net.ParseIP(r.PathValue("ip"))
+	if ip == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid ip address"}`)
+		return
+	}
+
+	// Forget the address's failed logins
+	err := cfg.LoginLimiter.UnlockIP(r.Context(), ip.String())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to unlock ip: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
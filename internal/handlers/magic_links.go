@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/evanwiseman/chirpy/internal/mail"
+)
+
+const magicLinkExpirationInMinutes = 15
+
+// magicLinkURL is the page of the web app a sign in link opens. The token
+// goes in the fragment so it isn't sent to the server or leaked in logs
+// and referrers, the page posts it to /api/login/magic/consume.
+func (cfg *APIConfig) magicLinkURL(token string) string {
+	return strings.TrimSuffix(cfg.AppURL, "/") + "/login/magic#token=" + url.QueryEscape(token)
+}
+
+func (cfg *APIConfig) HandlerRequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Decode the body into params
+	decoder := json.NewDecoder(r.Body)
+	params := struct {
+		Email string `json:"email"`
+	}{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid format: %v"}`, err)
+		return
+	}
+
+	// Hold off repeated requests for the email or from the address
+	if !cfg.allowMail(w, r, params.Email) {
+		return
+	}
+
+	// Find the user and mail them in the background, so the response is the
+	// same and takes as long whether or not they exist and can't be used to
+	// discover accounts
+	go cfg.mailMagicLink(params.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// mailMagicLink mails a sign in link to the user with email, if there is one
+func (cfg *APIConfig) mailMagicLink(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+	defer cancel()
+
+	dbUser, err := cfg.DB.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Printf("unable to get user: %v", err)
+		return
+	}
+
+	// Generate a sign in token, only its hash is stored
+	token, err := auth.MakeToken()
+	if err != nil {
+		log.Printf("couldn't generate sign in token: %v", err)
+		return
+	}
+	err = cfg.DB.CreateMagicLinkToken(ctx, database.CreateMagicLinkTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    dbUser.ID,
+		Email:     dbUser.Email,
+		ExpiresAt: time.Now().Add(magicLinkExpirationInMinutes * time.Minute),
+	})
+	if err != nil {
+		log.Printf("couldn't create sign in token in database: %v", err)
+		return
+	}
+
+	// Mail the link
+	cfg.sendMail(mail.Message{
+		To:      dbUser.Email,
+		Subject: "Sign in to Chirpy",
+		Body: fmt.Sprintf("Someone asked to sign in to your Chirpy account. Open this link to sign in:\n\n%s\n\n"+
+			"It expires in %d minutes and can be used once. If you didn't ask for this you can ignore this email.\n",
+			cfg.magicLinkURL(token), magicLinkExpirationInMinutes),
+	})
+}
+
+func (cfg *APIConfig) HandlerConsumeMagicLink(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Decode the body into params
+	decoder := json.NewDecoder(r.Body)
+	params := struct {
+		Token      string `json:"token"`
+		UseCookies bool   `json:"use_cookies"`
+	}{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid format: %v"}`, err)
+		return
+	}
+
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to begin transaction: %v"}`, err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	// Lock the sign in token so it can only be used once
+	magicLink, err := qtx.GetMagicLinkTokenForUpdate(r.Context(), auth.HashToken(params.Token))
+	if err != nil || magicLink.UsedAt.Valid || time.Now().After(magicLink.ExpiresAt) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "sign in link is invalid or has expired"}`)
+		return
+	}
+
+	// Opening the link proves the user owns their email, a link sent to an
+	// address they have since changed away from signs nobody in
+	dbUser, err := qtx.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+		ID:    magicLink.UserID,
+		Email: magicLink.Email,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "sign in link is invalid or has expired"}`)
+		return
+	}
+	err = qtx.UseMagicLinkTokens(r.Context(), dbUser.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to use sign in token: %v"}`, err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to commit transaction: %v"}`, err)
+		return
+	}
+	err = cfg.LoginLimiter.UnlockAccount(r.Context(), dbUser.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to record login attempt: %v"}`, err)
+		return
+	}
+
+	// With two-factor authentication on, the link only earns a challenge to
+	// be answered at /api/login/mfa like a password does
+	totpCredential, err := cfg.DB.GetTOTPCredential(r.Context(), dbUser.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to get two-factor settings: %v"}`, err)
+		return
+	}
+	if err == nil && totpCredential.ConfirmedAt.Valid {
+		cfg.writeMFAChallenge(w, dbUser.ID)
+		return
+	}
+
+	// Start a new session
+	resp, err := cfg.startSession(r, dbUser)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "couldn't start session: %v"}`, err)
+		return
+	}
+
+	// Browsers can keep the session in cookies instead of JavaScript storage
+	if params.UseCookies {
+		err = useSessionCookies(w, &resp)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "couldn't set session cookies: %v"}`, err)
+			return
+		}
+	}
+
+	// Pack response
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/evanwiseman/chirpy/internal/models"
+	"github.com/evanwiseman/chirpy/internal/pagination"
+	"github.com/google/uuid"
+)
+
+func (cfg *APIConfig) HandlerGetMentions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't get bearer token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	userID, err := cfg.authenticate(r.Context(), token, auth.ScopeChirpsRead)
+	if err != nil {
+		w.WriteHeader(authStatus(err))
+		fmt.Fprintf(w, `{"error": "couldn't validate jwt: %v"}`, err)
+		return
+	}
+
+	// Parse the page size, sort and cursor, newest first by default
+	page, err := pagination.ParseQuery(r.URL.Query(), pagination.SortDesc)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid page: %v"}`, err)
+		return
+	}
+	if page.Sort == pagination.SortTop {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid page: sort top is not supported here"}`)
+		return
+	}
+
+	// Fetch one extra row to find out if there is another page
+	params := database.ListMentionChirpsAscParams{
+		UserID: userID,
+		Limit:  int32(page.Limit + 1),
+	}
+	if page.Cursor != nil {
+		params.CursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+	var dbChirps []database.Chirp
+	if pagination.Ascending(page.Sort, page.Cursor) {
+		dbChirps, err = cfg.DB.ListMentionChirpsAsc(r.Context(), params)
+	} else {
+		dbChirps, err = cfg.DB.ListMentionChirpsDesc(r.Context(), database.ListMentionChirpsDescParams(params))
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to get mentions: %v"}`, err)
+		return
+	}
+
+	dbChirps, next, prev := pagination.Paginate(dbChirps, page.Limit, page.Sort, page.Cursor, chirpKey)
+
+	// Format a response
+	chirps, err := cfg.formatChirps(r.Context(), userID, dbChirps)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to format chirps: %v"}`, err)
+		return
+	}
+	resp := models.Page[models.Chirp]{
+		Data: chirps,
+		Next: next,
+		Prev: prev,
+	}
+
+	// Pack response
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	if link := pagination.LinkHeader(r.URL, next, prev); link != "" {
+		w.Header().Set("Link", link)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/evanwiseman/chirpy/internal/oauth"
+	"github.com/google/uuid"
+)
+
+const authorizationCodeExpirationInMinutes = 10
+
+// scopeDescriptions tell users on the consent page what a client is asking
+// to do
+var scopeDescriptions = map[string]string{
+	auth.ScopeChirpsRead:   "Read chirps, your timeline and your mentions",
+	auth.ScopeChirpsWrite:  "Post, edit, delete, like and rechirp chirps",
+	auth.ScopeFollowsWrite: "Follow and unfollow users",
+	auth.ScopeProfileWrite: "Edit your profile",
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Chirpy</title>
+</head>
+<body>
+{{if .Client}}
+<h1>Allow {{.Client}} to use your Chirpy account?</h1>
+<p>{{.Client}} is asking to:</p>
+<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end}}</ul>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/authorize">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<p><label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username" required></label></p>
+<p><label>Password <input type="password" name="password" autocomplete="current-password" required></label></p>
+<p><label>Two-factor or recovery code, if enabled <input type="text" name="code" autocomplete="one-time-code"></label></p>
+<p>
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny" formnovalidate>Deny</button>
+</p>
+</form>
+{{else}}
+<h1>Unable to authorize</h1>
+<p role="alert">{{.Error}}</p>
+{{end}}
+</body>
+</html>
+`))
+
+// consentPage is what the consent page shows. Without a client it only
+// shows the error, for requests that can't be sent back to the client.
+type consentPage struct {
+	Client string
+	Scopes []string
+	Params map[string]string
+	Email  string
+	Error  string
+}
+
+// renderConsent writes the consent page
+func renderConsent(w http.ResponseWriter, status int, page consentPage) {
+	renderPage(w, status, consentTemplate, page)
+}
+
+// renderPage writes an HTML page asking the user to grant access. It must
+// not be framed, so other sites can't trick users into clicking Allow.
+func renderPage(w http.ResponseWriter, status int, tmpl *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("unable to render %s page: %v", tmpl.Name(), err)
+	}
+}
+
+// pageError is a failure to show the user on the page they submitted
+type pageError struct {
+	status  int
+	message string
+}
+
+// checkGrantCredentials checks the credentials a user submitted to grant a
+// client access, including their two-factor or recovery code when two-factor
+// authentication is on. qtx must be in a transaction so the code is only
+// accepted once.
+func (cfg *APIConfig) checkGrantCredentials(r *http.Request, qtx *database.Queries) (database.User, *pageError) {
+	user, err := cfg.checkPassword(r, r.PostForm.Get("email"), r.PostForm.Get("password"))
+	var lockedOut *lockedOutError
+	if errors.As(err, &lockedOut) {
+		return user, &pageError{http.StatusTooManyRequests, "Too many failed login attempts, try again later."}
+	}
+	if errors.Is(err, errInvalidCredentials) {
+		return user, &pageError{http.StatusUnauthorized, "Invalid email or password."}
+	}
+	if err != nil {
+		return user, &pageError{http.StatusInternalServerError, "Unable to check your credentials, try again later."}
+	}
+
+	// With two-factor authentication on, the password isn't enough
+	credential, err := qtx.GetTOTPCredentialForUpdate(r.Context(), user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return user, &pageError{http.StatusInternalServerError, "Unable to check your credentials, try again later."}
+	}
+	if err == nil && credential.ConfirmedAt.Valid {
+		code, recoveryCode := strings.TrimSpace(r.PostForm.Get("code")), ""
+		if len(code) != 6 {
+			code, recoveryCode = "", code
+		}
+		verified, err := checkSecondFactor(r.Context(), qtx, credential, code, recoveryCode)
+		if err != nil {
+			return user, &pageError{http.StatusInternalServerError, "Unable to check your code, try again later."}
+		}
+		if !verified {
+			err = cfg.LoginLimiter.Fail(r.Context(), user.Email, clientIP(r))
+			if err != nil {
+				log.Printf("unable to record login attempt: %v", err)
+			}
+			return user, &pageError{http.StatusUnauthorized, "Invalid two-factor or recovery code."}
+		}
+	}
+	return user, nil
+}
+
+// authorizeRequest is a validated request for an authorization code
+type authorizeRequest struct {
+	Client        database.OauthClient
+	RedirectURI   string
+	State         string
+	Scopes        []string
+	CodeChallenge string
+}
+
+// parseAuthorizeRequest validates the parameters of an authorization
+// request. An *oauth.Error is returned once the redirect URI is known to be
+// the client's, so it can be reported to the client there. Any other error
+// must be shown to the user instead.
+func (cfg *APIConfig) parseAuthorizeRequest(ctx context.Context, form url.Values) (authorizeRequest, error) {
+	var req authorizeRequest
+
+	// Find the client and make sure the redirect is one it registered
+	clientID, err := uuid.Parse(form.Get("client_id"))
+	if err != nil {
+		return req, fmt.Errorf("invalid client_id")
+	}
+	req.Client, err = cfg.DB.GetOAuthClient(ctx, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return req, fmt.Errorf("unknown client")
+	}
+	if err != nil {
+		return req, fmt.Errorf("unable to get client: %v", err)
+	}
+	redirectURI := form.Get("redirect_uri")
+	if !slices.Contains(req.Client.RedirectUris, redirectURI) {
+		return req, fmt.Errorf("redirect_uri isn't registered for %s", req.Client.Name)
+	}
+	req.RedirectURI = redirectURI
+	req.State = form.Get("state")
+
+	// Every client must use PKCE, confidential or not
+	if form.Get("response_type") != "code" {
+		return req, oauth.Errorf(oauth.ErrUnsupportedResponseType, "response_type must be code")
+	}
+	if form.Get("code_challenge_method") != "S256" || !oauth.ValidChallenge(form.Get("code_challenge")) {
+		return req, oauth.Errorf(oauth.ErrInvalidRequest, "a code_challenge with code_challenge_method S256 is required")
+	}
+	req.CodeChallenge = form.Get("code_challenge")
+	req.Scopes, err = oauth.ParseScope(form.Get("scope"))
+	if err != nil {
+		return req, oauth.Errorf(oauth.ErrInvalidScope, "%v", err)
+	}
+	return req, nil
+}
+
+// consentPage returns the consent page for req, carrying its parameters
+// through the form
+func (req authorizeRequest) consentPage() consentPage {
+	page := consentPage{
+		Client: req.Client.Name,
+		Params: map[string]string{
+			"response_type":         "code",
+			"client_id":             req.Client.ID.String(),
+			"redirect_uri":          req.RedirectURI,
+			"scope":                 strings.Join(req.Scopes, " "),
+			"state":                 req.State,
+			"code_challenge":        req.CodeChallenge,
+			"code_challenge_method": "S256",
+		},
+	}
+	for _, scope := range req.Scopes {
+		page.Scopes = append(page.Scopes, scopeDescriptions[scope])
+	}
+	return page
+}
+
+// redirectAuthorizeError sends the user back to the client with err
+func redirectAuthorizeError(w http.ResponseWriter, r *http.Request, req authorizeRequest, err *oauth.Error) {
+	http.Redirect(w, r, oauth.RedirectURL(req.RedirectURI, url.Values{
+		"error":             {err.Code},
+		"error_description": {err.Description},
+		"state":             {req.State},
+	}), http.StatusSeeOther)
+}
+
+func (cfg *APIConfig) HandlerGetAuthorize(w http.ResponseWriter, r *http.Request) {
+	// Validate the authorization request
+	req, err := cfg.parseAuthorizeRequest(r.Context(), r.URL.Query())
+	var oauthErr *oauth.Error
+	if errors.As(err, &oauthErr) {
+		redirectAuthorizeError(w, r, req, oauthErr)
+		return
+	}
+	if err != nil {
+		renderConsent(w, http.StatusBadRequest, consentPage{Error: err.Error()})
+		return
+	}
+
+	renderConsent(w, http.StatusOK, req.consentPage())
+}
+
+func (cfg *APIConfig) HandlerPostAuthorize(w http.ResponseWriter, r *http.Request) {
+	// Validate the authorization request carried through the consent form
+	err := r.ParseForm()
+	if err != nil {
+		renderConsent(w, http.StatusBadRequest, consentPage{Error: "invalid form"})
+		return
+	}
+	req, err := cfg.parseAuthorizeRequest(r.Context(), r.PostForm)
+	var oauthErr *oauth.Error
+	if errors.As(err, &oauthErr) {
+		redirectAuthorizeError(w, r, req, oauthErr)
+		return
+	}
+	if err != nil {
+		renderConsent(w, http.StatusBadRequest, consentPage{Error: err.Error()})
+		return
+	}
+
+	// The user turned the client down
+	if r.PostForm.Get("decision") != "allow" {
+		redirectAuthorizeError(w, r, req, oauth.Errorf(oauth.ErrAccessDenied, "the user denied the request"))
+		return
+	}
+
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		renderConsent(w, http.StatusInternalServerError, consentPage{Error: "Unable to authorize, try again later."})
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	// Validate their credentials, mistakes show the form again
+	page := req.consentPage()
+	page.Email = r.PostForm.Get("email")
+	user, pageErr := cfg.checkGrantCredentials(r, qtx)
+	if pageErr != nil {
+		page.Error = pageErr.message
+		renderConsent(w, pageErr.status, page)
+		return
+	}
+
+	// Issue an authorization code, only its hash is stored. The tokens it
+	// is exchanged for start a new family, so they can be revoked together.
+	code, err := auth.MakeToken()
+	if err == nil {
+		err = qtx.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+			CodeHash:      auth.HashToken(code),
+			ClientID:      req.Client.ID,
+			UserID:        user.ID,
+			RedirectUri:   req.RedirectURI,
+			Scopes:        req.Scopes,
+			CodeChallenge: req.CodeChallenge,
+			FamilyID:      uuid.New(),
+			ExpiresAt:     time.Now().Add(authorizationCodeExpirationInMinutes * time.Minute),
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		page.Error = "Unable to authorize, try again later."
+		renderConsent(w, http.StatusInternalServerError, page)
+		return
+	}
+
+	http.Redirect(w, r, oauth.RedirectURL(req.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {req.State},
+	}), http.StatusSeeOther)
+}
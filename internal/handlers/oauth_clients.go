@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/evanwiseman/chirpy/internal/models"
+	"github.com/evanwiseman/chirpy/internal/oauth"
+	"github.com/google/uuid"
+)
+
+const (
+	maxClientNameLength   = 100
+	maxClientRedirectURIs = 10
+)
+
+func (cfg *APIConfig) HandlerCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't get bearer token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	userID, err := auth.ValidateJWT(token, cfg.Keys)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't validate jwt: %v"}`, err)
+		return
+	}
+
+	// Decode the body into params
+	decoder := json.NewDecoder(r.Body)
+	params := struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Confidential bool     `json:"confidential"`
+	}{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid format: %v"}`, err)
+		return
+	}
+
+	// Validate the params
+	name := strings.TrimSpace(params.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxClientNameLength {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "name must be 1-%d characters"}`, maxClientNameLength)
+		return
+	}
+	// Apps using only the device flow have nowhere to redirect to
+	if len(params.RedirectURIs) > maxClientRedirectURIs {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "redirect_uris must have at most %d entries"}`, maxClientRedirectURIs)
+		return
+	}
+	if params.RedirectURIs == nil {
+		params.RedirectURIs = []string{}
+	}
+	for _, uri := range params.RedirectURIs {
+		err = oauth.ValidateRedirectURI(uri)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"error": "invalid redirect uri: %v"}`, err)
+			return
+		}
+	}
+
+	// Confidential clients get a secret, only its hash is stored
+	var secret string
+	var secretHash sql.NullString
+	if params.Confidential {
+		secret, err = auth.MakeToken()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "couldn't generate client secret: %v"}`, err)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	dbClient, err := cfg.DB.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		UserID:       userID,
+		Name:         name,
+		SecretHash:   secretHash,
+		RedirectUris: params.RedirectURIs,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "couldn't create client in database: %v"}`, err)
+		return
+	}
+
+	// Pack response
+	data, err := json.Marshal(models.FormatOAuthClient(dbClient, secret))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(data)
+}
+
+func (cfg *APIConfig) HandlerGetOAuthClients(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't get bearer token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	userID, err := auth.ValidateJWT(token, cfg.Keys)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't validate jwt: %v"}`, err)
+		return
+	}
+
+	// Get the clients
+	dbClients, err := cfg.DB.ListOAuthClients(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to get clients: %v"}`, err)
+		return
+	}
+
+	// Format a response
+	clients := []models.OAuthClient{}
+	for _, dbClient := range dbClients {
+		clients = append(clients, models.FormatOAuthClient(dbClient, ""))
+	}
+
+	// Pack response
+	data, err := json.Marshal(clients)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (cfg *APIConfig) HandlerDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't get bearer token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	userID, err := auth.ValidateJWT(token, cfg.Keys)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't validate jwt: %v"}`, err)
+		return
+	}
+
+	// Parse the client ID
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid clientID: %v"}`, err)
+		return
+	}
+
+	// Delete the client along with the refresh tokens it was issued, other
+	// users' clients are reported as not found
+	rows, err := cfg.DB.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:     clientID,
+		UserID: userID,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to delete client: %v"}`, err)
+		return
+	}
+	if rows == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "no client with id '%v'"}`, clientID)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/evanwiseman/chirpy/internal/oauth"
+	"github.com/google/uuid"
+)
+
+const (
+	deviceCodeExpirationInMinutes = 15
+	// devicePollIntervalInSeconds is how long devices wait between polls,
+	// polling too fast adds deviceSlowDownInSeconds to the wait
+	devicePollIntervalInSeconds = 5
+	deviceSlowDownInSeconds     = 5
+)
+
+var deviceTemplate = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Chirpy</title>
+</head>
+<body>
+{{if .Client}}
+<h1>Allow {{.Client}} to use your Chirpy account?</h1>
+<p>Only continue if your device shows the code <strong>{{.UserCode}}</strong>.</p>
+<p>{{.Client}} is asking to:</p>
+<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end}}</ul>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/device">
+<input type="hidden" name="user_code" value="{{.UserCode}}">
+<p><label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username" required></label></p>
+<p><label>Password <input type="password" name="password" autocomplete="current-password" required></label></p>
+<p><label>Two-factor or recovery code, if enabled <input type="text" name="code" autocomplete="one-time-code"></label></p>
+<p>
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</p>
+</form>
+{{else if .Message}}
+<h1>{{.Message}}</h1>
+{{else}}
+<h1>Connect a device</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="get" action="/oauth/device">
+<p><label>Enter the code shown on your device <input type="text" name="user_code" value="{{.UserCode}}" autocomplete="off" autocapitalize="characters" required></label></p>
+<p><button type="submit">Continue</button></p>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// devicePage is what the device verification page shows. Without a client
+// it asks for a user code, or shows Message once the request is decided.
+type devicePage struct {
+	UserCode string
+	Client   string
+	Scopes   []string
+	Email    string
+	Error    string
+	Message  string
+}
+
+// getPendingDeviceCode returns the device authorization request waiting for
+// the user to approve it with userCode, and the page asking them to. A
+// *pageError is returned when there is no such request.
+func (cfg *APIConfig) getPendingDeviceCode(r *http.Request, userCode string) (database.OauthDeviceCode, devicePage, *pageError) {
+	page := devicePage{UserCode: userCode}
+
+	// Hold off addresses that keep trying codes that don't exist, every
+	// lookup counts until the code is found
+	ip := clientIP(r)
+	retryAt, err := cfg.CodeLimiter.AttemptFrom(r.Context(), ip)
+	if err != nil {
+		return database.OauthDeviceCode{}, page, &pageError{http.StatusInternalServerError, "Unable to look up the code, try again later."}
+	}
+	if !retryAt.IsZero() {
+		return database.OauthDeviceCode{}, page, &pageError{http.StatusTooManyRequests, "Too many codes tried, try again later."}
+	}
+
+	deviceCode, err := cfg.DB.GetOAuthDeviceCodeByUserCode(r.Context(), oauth.NormalizeUserCode(userCode))
+	if errors.Is(err, sql.ErrNoRows) || err == nil &&
+		(deviceCode.ApprovedAt.Valid || deviceCode.DeniedAt.Valid || time.Now().After(deviceCode.ExpiresAt)) {
+		return deviceCode, page, &pageError{http.StatusNotFound, "That code is invalid or has expired, check your device and try again."}
+	}
+	if err != nil {
+		return deviceCode, page, &pageError{http.StatusInternalServerError, "Unable to look up the code, try again later."}
+	}
+	err = cfg.CodeLimiter.SucceedFrom(r.Context(), ip)
+	if err != nil {
+		log.Printf("unable to record code lookup: %v", err)
+	}
+	client, err := cfg.DB.GetOAuthClient(r.Context(), deviceCode.ClientID)
+	if err != nil {
+		return deviceCode, page, &pageError{http.StatusInternalServerError, "Unable to look up the code, try again later."}
+	}
+
+	page.UserCode = oauth.FormatUserCode(deviceCode.UserCode)
+	page.Client = client.Name
+	for _, scope := range deviceCode.Scopes {
+		page.Scopes = append(page.Scopes, scopeDescriptions[scope])
+	}
+	return deviceCode, page, nil
+}
+
+// verificationURI is the page users enter the user code on, at the host
+// the device reached chirpy at
+func verificationURI(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/oauth/device"
+}
+
+func (cfg *APIConfig) HandlerOAuthDeviceCode(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Parse the form encoded request
+	err := r.ParseForm()
+	if err != nil {
+		writeOAuthError(w, oauth.Errorf(oauth.ErrInvalidRequest, "invalid form: %v", err))
+		return
+	}
+
+	// Authenticate the client
+	client, err := cfg.authenticateClient(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	scopes, err := oauth.ParseScope(r.PostForm.Get("scope"))
+	if err != nil {
+		writeOAuthError(w, oauth.Errorf(oauth.ErrInvalidScope, "%v", err))
+		return
+	}
+
+	// Issue a device code for the device to poll with, only its hash is
+	// stored, and a short user code for the user to type in. The tokens it
+	// is exchanged for start a new family, so they can be revoked together.
+	deviceCode, err := auth.MakeToken()
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	userCode := oauth.MakeUserCode()
+	err = cfg.DB.CreateOAuthDeviceCode(r.Context(), database.CreateOAuthDeviceCodeParams{
+		DeviceCodeHash: auth.HashToken(deviceCode),
+		UserCode:       oauth.NormalizeUserCode(userCode),
+		ClientID:       client.ID,
+		Scopes:         scopes,
+		FamilyID:       uuid.New(),
+		PollInterval:   devicePollIntervalInSeconds,
+		ExpiresAt:      time.Now().Add(deviceCodeExpirationInMinutes * time.Minute),
+	})
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	// Pack response
+	uri := verificationURI(r)
+	data, err := json.Marshal(struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		ExpiresIn               int    `json:"expires_in"`
+		Interval                int    `json:"interval"`
+	}{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         uri,
+		VerificationURIComplete: oauth.RedirectURL(uri, url.Values{"user_code": {userCode}}),
+		ExpiresIn:               deviceCodeExpirationInMinutes * 60,
+		Interval:                devicePollIntervalInSeconds,
+	})
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (cfg *APIConfig) HandlerGetDevice(w http.ResponseWriter, r *http.Request) {
+	// Ask for the user code until the user has given one
+	userCode := r.URL.Query().Get("user_code")
+	if userCode == "" {
+		renderPage(w, http.StatusOK, deviceTemplate, devicePage{})
+		return
+	}
+
+	_, page, pageErr := cfg.getPendingDeviceCode(r, userCode)
+	if pageErr != nil {
+		page.Error = pageErr.message
+		renderPage(w, pageErr.status, deviceTemplate, page)
+		return
+	}
+	renderPage(w, http.StatusOK, deviceTemplate, page)
+}
+
+func (cfg *APIConfig) HandlerPostDevice(w http.ResponseWriter, r *http.Request) {
+	// Find the request the user is deciding on
+	err := r.ParseForm()
+	if err != nil {
+		renderPage(w, http.StatusBadRequest, deviceTemplate, devicePage{Error: "Invalid form."})
+		return
+	}
+	deviceCode, page, pageErr := cfg.getPendingDeviceCode(r, r.PostForm.Get("user_code"))
+	if pageErr != nil {
+		page.Error = pageErr.message
+		renderPage(w, pageErr.status, deviceTemplate, page)
+		return
+	}
+
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		page.Error = "Unable to authorize, try again later."
+		renderPage(w, http.StatusInternalServerError, deviceTemplate, page)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	// Validate their credentials whichever way they decide, so only the
+	// user can turn a request down. Mistakes show the form again.
+	page.Email = r.PostForm.Get("email")
+	user, pageErr := cfg.checkGrantCredentials(r, qtx)
+	if pageErr != nil {
+		page.Error = pageErr.message
+		renderPage(w, pageErr.status, deviceTemplate, page)
+		return
+	}
+
+	// The user turned the device down, it learns so on its next poll
+	if r.PostForm.Get("decision") != "allow" {
+		denied, err := qtx.DenyOAuthDeviceCode(r.Context(), deviceCode.UserCode)
+		if err == nil && denied == 0 {
+			renderPage(w, http.StatusNotFound, deviceTemplate, devicePage{Error: "That code is invalid or has expired, check your device and try again."})
+			return
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			page.Error = "Unable to deny the request, try again later."
+			renderPage(w, http.StatusInternalServerError, deviceTemplate, page)
+			return
+		}
+		renderPage(w, http.StatusOK, deviceTemplate, devicePage{Message: "Request denied, your device won't be connected."})
+		return
+	}
+
+	// Approve the request, unless it expired or was decided meanwhile
+	approved, err := qtx.ApproveOAuthDeviceCode(r.Context(), database.ApproveOAuthDeviceCodeParams{
+		UserCode: deviceCode.UserCode,
+		UserID:   uuid.NullUUID{UUID: user.ID, Valid: true},
+	})
+	if err == nil && approved == 0 {
+		renderPage(w, http.StatusNotFound, deviceTemplate, devicePage{Error: "That code is invalid or has expired, check your device and try again."})
+		return
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		page.Error = "Unable to authorize, try again later."
+		renderPage(w, http.StatusInternalServerError, deviceTemplate, page)
+		return
+	}
+
+	renderPage(w, http.StatusOK, deviceTemplate, devicePage{Message: "Your device is connected, you can return to it now."})
+}
@@ -0,0 +1,455 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/evanwiseman/chirpy/internal/oauth"
+	"github.com/google/uuid"
+)
+
+// tokenResponse is a successful response from /oauth/token
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// writeOAuthError writes err as the JSON error response of RFC 6749.
+// Errors that aren't an *oauth.Error are logged and reported as a server
+// error.
+func writeOAuthError(w http.ResponseWriter, err error) {
+	var oauthErr *oauth.Error
+	status := http.StatusBadRequest
+	if !errors.As(err, &oauthErr) {
+		log.Printf("oauth request failed: %v", err)
+		oauthErr = oauth.Errorf(oauth.ErrServerError, "the server was unable to handle the request")
+		status = http.StatusInternalServerError
+	} else if oauthErr.Code == oauth.ErrInvalidClient {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		status = http.StatusUnauthorized
+	}
+
+	data, _ := json.Marshal(oauthErr)
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// authenticateClient returns the client making a request to the token,
+// revocation or introspection endpoint. Clients authenticate with HTTP
+// basic auth or with client_id and client_secret form fields, public
+// clients just send their client_id.
+func (cfg *APIConfig) authenticateClient(r *http.Request) (database.OauthClient, error) {
+	clientIDStr, secret, ok := r.BasicAuth()
+	if ok {
+		// RFC 6749 has the credentials form encoded before they are joined
+		clientIDStr, _ = url.QueryUnescape(clientIDStr)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientIDStr = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	clientID, err := uuid.Parse(clientIDStr)
+	if err != nil {
+		return database.OauthClient{}, oauth.Errorf(oauth.ErrInvalidClient, "invalid client_id")
+	}
+	client, err := cfg.DB.GetOAuthClient(r.Context(), clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthClient{}, oauth.Errorf(oauth.ErrInvalidClient, "unknown client")
+	}
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+
+	if client.SecretHash.Valid {
+		hash := auth.HashToken(secret)
+		if secret == "" || subtle.ConstantTimeCompare([]byte(hash), []byte(client.SecretHash.String)) != 1 {
+			return database.OauthClient{}, oauth.Errorf(oauth.ErrInvalidClient, "invalid client credentials")
+		}
+	}
+	return client, nil
+}
+
+// issueClientTokens makes the response to a successful token request
+func (cfg *APIConfig) issueClientTokens(userID, familyID, clientID uuid.UUID, scopes []string, refreshToken string) (tokenResponse, error) {
+	expiresIn := time.Duration(jwtExpirationInSeconds) * time.Second
+	accessToken, err := auth.MakeClientJWT(userID, familyID, clientID, scopes, cfg.Keys, expiresIn)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	return tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    jwtExpirationInSeconds,
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	}, nil
+}
+
+// exchangeAuthorizationCode redeems an authorization code from
+// /oauth/authorize for tokens
+func (cfg *APIConfig) exchangeAuthorizationCode(r *http.Request, client database.OauthClient) (tokenResponse, error) {
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	// Lock the code so it can only be redeemed once
+	code, err := qtx.GetOAuthAuthorizationCodeForUpdate(r.Context(), auth.HashToken(r.PostForm.Get("code")))
+	if errors.Is(err, sql.ErrNoRows) || err == nil && code.ClientID != client.ID {
+		return tokenResponse{}, oauth.Errorf(oauth.ErrInvalidGrant, "unknown authorization code")
+	}
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	// Code was already redeemed, someone is replaying it so revoke what it
+	// was exchanged for
+	if code.UsedAt.Valid {
+		err = qtx.RevokeRefreshTokenFamily(r.Context(), code.FamilyID)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			return tokenResponse{}, err
+		}
+		return tokenResponse{}, oauth.Errorf(oauth.ErrInvalidGrant, "authorization code has already been used")
+	}
+	if time.Now().After(code.ExpiresAt) {
+		return tokenResponse{}, oauth.Errorf(oauth.ErrInvalidGrant, "authorization code has expired")
+	}
+	if r.PostForm.Get("redirect_uri") != code.RedirectUri {
+		return tokenResponse{}, oauth.Errorf(oauth.ErrInvalidGrant, "redirect_uri doesn't match the authorization request")
+	}
+	if !oauth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		return tokenResponse{}, oauth.Errorf(oauth.ErrInvalidGrant, "code_verifier doesn't match the code_challenge")
+	}
+
+	// Redeem the code for a refresh token in the family it started
+	err = qtx.UseOAuthAuthorizationCode(r.Context(), code.CodeHash)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	clientID := uuid.NullUUID{UUID: client.ID, Valid: true}
+	refreshToken, err := createClientRefreshToken(r, qtx, code.UserID, code.FamilyID, clientID, code.Scopes)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	return cfg.issueClientTokens(code.UserID, code.FamilyID, client.ID, code.Scopes, refreshToken)
+}
+
+// exchangeDeviceCode redeems a device code from /oauth/device/code for
+// tokens once the user has approved it at /oauth/device
+func (cfg *APIConfig) exchangeDeviceCode(r *http.Request, client database.OauthClient) (tokenResponse, error) {
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	// Lock the device code so it can only be redeemed once
+	deviceCode, err := qtx.GetOAuthDeviceCodeForUpdate(r.Context(), auth.HashToken(r.PostForm.Get("device_code")))
+	if errors.Is(err, sql.ErrNoRows) || err == nil && deviceCode.ClientID != client.ID {
+		return tokenResponse{}, oauth.Errorf(oauth.ErrInvalidGrant, "unknown device code")
+	}
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	if deviceCode.UsedAt.Valid {
+		return tokenResponse{}, oauth.Errorf(oauth.ErrInvalidGrant, "device code has already been used")
+	}
+	if time.Now().After(deviceCode.ExpiresAt) {
+		return tokenResponse{}, oauth.Errorf(oauth.ErrExpiredToken, "device code has expired")
+	}
+	if deviceCode.DeniedAt.Valid {
+		return tokenResponse{}, oauth.Errorf(oauth.ErrAccessDenied, "the user denied the request")
+	}
+
+	// Until the user decides, the device keeps polling. Devices polling
+	// faster than the interval are told to wait longer.
+	if !deviceCode.ApprovedAt.Valid {
+		now := time.Now()
+		interval := deviceCode.PollInterval
+		pollErr := oauth.Errorf(oauth.ErrAuthorizationPending, "the user hasn't approved the request yet")
+		if deviceCode.LastPolledAt.Valid && now.Sub(deviceCode.LastPolledAt.Time) < time.Duration(interval)*time.Second {
+			interval += deviceSlowDownInSeconds
+			pollErr = oauth.Errorf(oauth.ErrSlowDown, "poll every %d seconds at most", interval)
+		}
+		err = qtx.PollOAuthDeviceCode(r.Context(), database.PollOAuthDeviceCodeParams{
+			DeviceCodeHash: deviceCode.DeviceCodeHash,
+			LastPolledAt:   sql.NullTime{Time: now, Valid: true},
+			PollInterval:   interval,
+		})
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			return tokenResponse{}, err
+		}
+		return tokenResponse{}, pollErr
+	}
+
+	// Redeem the code for a refresh token in the family it started
+	err = qtx.UseOAuthDeviceCode(r.Context(), deviceCode.DeviceCodeHash)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	userID := deviceCode.UserID.UUID
+	clientID := uuid.NullUUID{UUID: client.ID, Valid: true}
+	refreshToken, err := createClientRefreshToken(r, qtx, userID, deviceCode.FamilyID, clientID, deviceCode.Scopes)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	return cfg.issueClientTokens(userID, deviceCode.FamilyID, client.ID, deviceCode.Scopes, refreshToken)
+}
+
+// exchangeRefreshToken rotates a refresh token issued to client. The
+// access token may be limited to fewer scopes than were granted.
+func (cfg *APIConfig) exchangeRefreshToken(r *http.Request, client database.OauthClient) (tokenResponse, error) {
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	// Lock the refresh token so concurrent refreshes rotate it only once
+	dbRefreshToken, err := qtx.GetRefreshTokenForUpdate(r.Context(), r.PostForm.Get("refresh_token"))
+	if errors.Is(err, sql.ErrNoRows) || err == nil && dbRefreshToken.ClientID.UUID != client.ID {
+		return tokenResponse{}, oauth.Errorf(oauth.ErrInvalidGrant, "unknown refresh token")
+	}
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	// Token was already rotated, someone is replaying it so end the grant
+	if dbRefreshToken.ReplacedBy.Valid {
+		err = qtx.RevokeRefreshTokenFamily(r.Context(), dbRefreshToken.FamilyID)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			return tokenResponse{}, err
+		}
+		return tokenResponse{}, oauth.Errorf(oauth.ErrInvalidGrant, "refresh token has already been used")
+	}
+	if dbRefreshToken.RevokedAt.Valid {
+		return tokenResponse{}, oauth.Errorf(oauth.ErrInvalidGrant, "refresh token has been revoked")
+	}
+	if time.Now().After(dbRefreshToken.ExpiresAt) {
+		return tokenResponse{}, oauth.Errorf(oauth.ErrInvalidGrant, "refresh token has expired")
+	}
+
+	scopes := dbRefreshToken.Scopes
+	if r.PostForm.Get("scope") != "" {
+		scopes, err = oauth.ParseScope(r.PostForm.Get("scope"))
+		if err != nil {
+			return tokenResponse{}, oauth.Errorf(oauth.ErrInvalidScope, "%v", err)
+		}
+		for _, scope := range scopes {
+			if !slices.Contains(dbRefreshToken.Scopes, scope) {
+				return tokenResponse{}, oauth.Errorf(oauth.ErrInvalidScope, "%s wasn't granted", scope)
+			}
+		}
+	}
+
+	// Rotate the refresh token
+	newRefreshToken, err := rotateRefreshToken(r, qtx, dbRefreshToken)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	return cfg.issueClientTokens(dbRefreshToken.UserID, dbRefreshToken.FamilyID, client.ID, scopes, newRefreshToken)
+}
+
+func (cfg *APIConfig) HandlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	// Parse the form encoded request
+	err := r.ParseForm()
+	if err != nil {
+		writeOAuthError(w, oauth.Errorf(oauth.ErrInvalidRequest, "invalid form: %v", err))
+		return
+	}
+
+	// Authenticate the client
+	client, err := cfg.authenticateClient(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	// Exchange the grant for tokens
+	var resp tokenResponse
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		resp, err = cfg.exchangeAuthorizationCode(r, client)
+	case "refresh_token":
+		resp, err = cfg.exchangeRefreshToken(r, client)
+	case oauth.GrantTypeDeviceCode:
+		resp, err = cfg.exchangeDeviceCode(r, client)
+	default:
+		err = oauth.Errorf(oauth.ErrUnsupportedGrantType, "grant_type must be authorization_code, refresh_token or %s", oauth.GrantTypeDeviceCode)
+	}
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	// Pack response
+	data, err := json.Marshal(resp)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (cfg *APIConfig) HandlerOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Parse the form encoded request
+	err := r.ParseForm()
+	if err != nil {
+		writeOAuthError(w, oauth.Errorf(oauth.ErrInvalidRequest, "invalid form: %v", err))
+		return
+	}
+
+	// Authenticate the client
+	client, err := cfg.authenticateClient(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	// Revoke the token if it was issued to the client. Unknown tokens are
+	// ignored, the client only needs to know the token is no longer valid.
+	token := r.PostForm.Get("token")
+	accessToken, err := auth.ParseAccessToken(token, cfg.Keys)
+	if err == nil {
+		if accessToken.ClientID == client.ID && accessToken.ID != "" {
+			err = cfg.RevokedTokens.Revoke(r.Context(), accessToken.ID, accessToken.UserID, accessToken.ExpiresAt)
+			if err != nil {
+				writeOAuthError(w, err)
+				return
+			}
+		}
+	} else {
+		dbRefreshToken, err := cfg.DB.GetRefreshToken(r.Context(), token)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			writeOAuthError(w, err)
+			return
+		}
+		if err == nil && dbRefreshToken.ClientID.UUID == client.ID {
+			err = cfg.DB.RevokeRefreshTokenFamily(r.Context(), dbRefreshToken.FamilyID)
+			if err != nil {
+				writeOAuthError(w, err)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (cfg *APIConfig) HandlerOAuthIntrospect(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Parse the form encoded request
+	err := r.ParseForm()
+	if err != nil {
+		writeOAuthError(w, oauth.Errorf(oauth.ErrInvalidRequest, "invalid form: %v", err))
+		return
+	}
+
+	// Authenticate the client
+	client, err := cfg.authenticateClient(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	// Describe the token, clients may only introspect their own tokens and
+	// anything else is reported as inactive
+	resp := struct {
+		Active    bool   `json:"active"`
+		Scope     string `json:"scope,omitempty"`
+		ClientID  string `json:"client_id,omitempty"`
+		Sub       string `json:"sub,omitempty"`
+		Exp       int64  `json:"exp,omitempty"`
+		Iat       int64  `json:"iat,omitempty"`
+		TokenType string `json:"token_type,omitempty"`
+	}{}
+	token := r.PostForm.Get("token")
+	accessToken, err := auth.ParseAccessToken(token, cfg.Keys)
+	if err == nil {
+		if accessToken.ClientID == client.ID {
+			resp.Active = true
+			resp.Scope = strings.Join(accessToken.Scopes, " ")
+			resp.ClientID = client.ID.String()
+			resp.Sub = accessToken.UserID.String()
+			resp.Exp = accessToken.ExpiresAt.Unix()
+			resp.Iat = accessToken.IssuedAt.Unix()
+			resp.TokenType = "access_token"
+		}
+	} else {
+		dbRefreshToken, err := cfg.DB.GetRefreshToken(r.Context(), token)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			writeOAuthError(w, err)
+			return
+		}
+		if err == nil && dbRefreshToken.ClientID.UUID == client.ID &&
+			!dbRefreshToken.RevokedAt.Valid && time.Now().Before(dbRefreshToken.ExpiresAt) {
+			resp.Active = true
+			resp.Scope = strings.Join(dbRefreshToken.Scopes, " ")
+			resp.ClientID = client.ID.String()
+			resp.Sub = dbRefreshToken.UserID.String()
+			resp.Exp = dbRefreshToken.ExpiresAt.Unix()
+			resp.Iat = dbRefreshToken.CreatedAt.Unix()
+			resp.TokenType = "refresh_token"
+		}
+	}
+
+	// Pack response
+	data, err := json.Marshal(resp)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/database"
+)
+
+const (
+	oidcLoginExpirationInMinutes = 10
+	// oidcStateCookie holds the hash of a sign in's state in the browser
+	// that started it, so no other browser can be made to finish it
+	oidcStateCookie = "__Secure-chirpy_oidc_state"
+	oidcCookiePath  = "/api/login/oidc"
+)
+
+// oidcResultURL is the web app page a sign in with the provider ends on.
+// The outcome is in the fragment, which browsers don't send to servers.
+func (cfg *APIConfig) oidcResultURL(params url.Values) string {
+	return strings.TrimSuffix(cfg.AppURL, "/") + "/login/oidc#" + params.Encode()
+}
+
+// redirectOIDCError sends the browser back to the web app with one of a
+// fixed set of error codes, nothing from the request is reflected
+func (cfg *APIConfig) redirectOIDCError(w http.ResponseWriter, r *http.Request, code, description string) {
+	http.Redirect(w, r, cfg.oidcResultURL(url.Values{
+		"error":             {code},
+		"error_description": {description},
+	}), http.StatusSeeOther)
+}
+
+// setOIDCStateCookie remembers stateHash in the browser for as long as the
+// sign in may take, an empty stateHash clears it. Lax so it is sent when
+// the provider redirects back.
+func setOIDCStateCookie(w http.ResponseWriter, stateHash string) {
+	maxAge := oidcLoginExpirationInMinutes * 60
+	if stateHash == "" {
+		maxAge = -1
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    stateHash,
+		Path:     oidcCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// RunOIDCLoginStatePruning deletes the states of sign ins that expired
+// without being completed every interval until ctx is done
+func (cfg *APIConfig) RunOIDCLoginStatePruning(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := cfg.DB.DeleteExpiredOIDCLoginStates(ctx, time.Now()); err != nil {
+				log.Printf("unable to prune oidc login states: %v", err)
+			}
+		}
+	}
+}
+
+func (cfg *APIConfig) HandlerOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if cfg.OIDC == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "sign in with an identity provider isn't configured"}`)
+		return
+	}
+
+	// Generate the state, nonce and PKCE verifier tying the provider's
+	// response to this request, only the state's hash is stored
+	var state, nonce, verifier string
+	var err error
+	for _, s := range []*string{&state, &nonce, &verifier} {
+		*s, err = auth.MakeToken()
+		if err != nil {
+			log.Printf("couldn't generate oidc login state: %v", err)
+			cfg.redirectOIDCError(w, r, "server_error", "Unable to sign in, try again later.")
+			return
+		}
+	}
+	stateHash := auth.HashToken(state)
+	err = cfg.DB.CreateOIDCLoginState(r.Context(), database.CreateOIDCLoginStateParams{
+		StateHash:    stateHash,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcLoginExpirationInMinutes * time.Minute),
+	})
+	if err != nil {
+		log.Printf("couldn't create oidc login state in database: %v", err)
+		cfg.redirectOIDCError(w, r, "server_error", "Unable to sign in, try again later.")
+		return
+	}
+
+	// Send the user to the provider
+	authURL, err := cfg.OIDC.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("unable to reach identity provider: %v", err)
+		cfg.redirectOIDCError(w, r, "server_error", "Unable to reach the identity provider, try again later.")
+		return
+	}
+	setOIDCStateCookie(w, stateHash)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (cfg *APIConfig) HandlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if cfg.OIDC == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "sign in with an identity provider isn't configured"}`)
+		return
+	}
+
+	// The state cookie is only good for this one attempt
+	stateCookie, _ := r.Cookie(oidcStateCookie)
+	setOIDCStateCookie(w, "")
+
+	// The provider reports failures, like the user declining, as an error
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		cfg.redirectOIDCError(w, r, "access_denied", "The identity provider didn't sign you in.")
+		return
+	}
+
+	// The response must come back to the browser that started the sign in
+	stateHash := auth.HashToken(query.Get("state"))
+	if stateCookie == nil || subtle.ConstantTimeCompare([]byte(stateCookie.Value), []byte(stateHash)) != 1 {
+		cfg.redirectOIDCError(w, r, "invalid_state", "Sign in wasn't started from this browser, try again.")
+		return
+	}
+
+	// Use up the login state so the response can only be redeemed once
+	loginState, err := cfg.DB.DeleteOIDCLoginState(r.Context(), stateHash)
+	if err != nil || time.Now().After(loginState.ExpiresAt) {
+		cfg.redirectOIDCError(w, r, "invalid_state", "Sign in took too long, try again.")
+		return
+	}
+
+	// Redeem the code for the provider's verified ID token
+	identity, err := cfg.OIDC.Exchange(r.Context(), query.Get("code"), loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("unable to sign in with identity provider: %v", err)
+		cfg.redirectOIDCError(w, r, "login_failed", "Unable to sign in with the identity provider.")
+		return
+	}
+
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("unable to begin transaction: %v", err)
+		cfg.redirectOIDCError(w, r, "server_error", "Unable to sign in, try again later.")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	// Find the account the identity is linked to
+	var dbUser database.User
+	linked, err := qtx.GetUserIdentity(r.Context(), database.GetUserIdentityParams{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+	})
+	if err == nil {
+		dbUser, err = qtx.GetUser(r.Context(), linked.UserID)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("unable to get user: %v", err)
+		cfg.redirectOIDCError(w, r, "server_error", "Unable to sign in, try again later.")
+		return
+	}
+
+	// Otherwise link it to the account with the same email, but only when
+	// both the provider and the account have verified the email. An
+	// unverified account may have been signed up by someone else, who would
+	// keep its password.
+	if errors.Is(err, sql.ErrNoRows) {
+		if identity.CanLink(true) != nil {
+			cfg.redirectOIDCError(w, r, "email_not_verified", "The identity provider hasn't verified your email.")
+			return
+		}
+		dbUser, err = qtx.GetUserByEmail(r.Context(), identity.Email)
+		if errors.Is(err, sql.ErrNoRows) {
+			cfg.redirectOIDCError(w, r, "account_not_found", "No account uses this email, sign up first.")
+			return
+		}
+		if err == nil && identity.CanLink(dbUser.EmailVerifiedAt.Valid) != nil {
+			cfg.redirectOIDCError(w, r, "account_not_verified", "Sign in with your password and verify your email first, then sign in with the identity provider.")
+			return
+		}
+		if err == nil {
+			err = qtx.CreateUserIdentity(r.Context(), database.CreateUserIdentityParams{
+				Issuer:  identity.Issuer,
+				Subject: identity.Subject,
+				UserID:  dbUser.ID,
+				Email:   identity.Email,
+			})
+		}
+		if err != nil {
+			log.Printf("unable to link identity: %v", err)
+			cfg.redirectOIDCError(w, r, "server_error", "Unable to sign in, try again later.")
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("unable to commit transaction: %v", err)
+		cfg.redirectOIDCError(w, r, "server_error", "Unable to sign in, try again later.")
+		return
+	}
+
+	// With two-factor authentication on, the provider only earns a
+	// challenge to be answered at /api/login/mfa like a password does
+	totpCredential, err := cfg.DB.GetTOTPCredential(r.Context(), dbUser.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("unable to get two-factor settings: %v", err)
+		cfg.redirectOIDCError(w, r, "server_error", "Unable to sign in, try again later.")
+		return
+	}
+	if err == nil && totpCredential.ConfirmedAt.Valid {
+		mfaToken, err := auth.MakeMFAToken(dbUser.ID, cfg.Keys, mfaTokenExpirationInMinutes*time.Minute)
+		if err != nil {
+			log.Printf("couldn't generate mfa token: %v", err)
+			cfg.redirectOIDCError(w, r, "server_error", "Unable to sign in, try again later.")
+			return
+		}
+		http.Redirect(w, r, cfg.oidcResultURL(url.Values{"mfa_token": {mfaToken}}), http.StatusSeeOther)
+		return
+	}
+
+	// Start a new session. Sign in happens in the browser, so the session
+	// always lives in cookies and the tokens never appear in a URL.
+	resp, err := cfg.startSession(r, dbUser)
+	if err == nil {
+		err = useSessionCookies(w, &resp)
+	}
+	if err != nil {
+		log.Printf("couldn't start session: %v", err)
+		cfg.redirectOIDCError(w, r, "server_error", "Unable to sign in, try again later.")
+		return
+	}
+	http.Redirect(w, r, cfg.oidcResultURL(url.Values{"csrf_token": {resp.CSRFToken}}), http.StatusSeeOther)
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/evanwiseman/chirpy/internal/mail"
+	"github.com/evanwiseman/chirpy/internal/passwords"
+)
+
+const resetTokenExpirationInMinutes = 60
+
+func (cfg *APIConfig) HandlerForgotPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Decode the body into params
+	decoder := json.NewDecoder(r.Body)
+	params := struct {
+		Email string `json:"email"`
+	}{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid format: %v"}`, err)
+		return
+	}
+
+	// Hold off repeated requests for the email or from the address
+	if !cfg.allowMail(w, r, params.Email) {
+		return
+	}
+
+	// Find the user and mail them in the background, so the response is the
+	// same and takes as long whether or not they exist and can't be used to
+	// discover accounts
+	go cfg.mailPasswordReset(params.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// mailPasswordReset mails a reset token to the user with email, if there
+// is one
+func (cfg *APIConfig) mailPasswordReset(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+	defer cancel()
+
+	dbUser, err := cfg.DB.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Printf("unable to get user: %v", err)
+		return
+	}
+
+	// Generate a reset token, only its hash is stored
+	token, err := auth.MakeToken()
+	if err != nil {
+		log.Printf("couldn't generate reset token: %v", err)
+		return
+	}
+	err = cfg.DB.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    dbUser.ID,
+		ExpiresAt: time.Now().Add(resetTokenExpirationInMinutes * time.Minute),
+	})
+	if err != nil {
+		log.Printf("couldn't create reset token in database: %v", err)
+		return
+	}
+
+	// Mail the token
+	cfg.sendMail(mail.Message{
+		To:      dbUser.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\n"+
+			"Your reset token is:\n\n%s\n\n"+
+			"It expires in %d minutes and can be used once. If you didn't ask for this you can ignore this email.\n",
+			token, resetTokenExpirationInMinutes),
+	})
+}
+
+func (cfg *APIConfig) HandlerResetPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Decode the body into params
+	decoder := json.NewDecoder(r.Body)
+	params := struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid format: %v"}`, err)
+		return
+	}
+	if params.Password == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "password is required"}`)
+		return
+	}
+
+	// Make sure the password is strong enough
+	err = cfg.PasswordPolicy.Check(params.Password)
+	if errors.Is(err, passwords.ErrWeakPassword) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "%v"}`, err)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to check password: %v"}`, err)
+		return
+	}
+
+	// Hash the new password
+	hashedPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "failed to hash password: %v"}`, err)
+		return
+	}
+
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to begin transaction: %v"}`, err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	// Lock the reset token so it can only be used once
+	resetToken, err := qtx.GetPasswordResetTokenForUpdate(r.Context(), auth.HashToken(params.Token))
+	if err != nil || resetToken.UsedAt.Valid || time.Now().After(resetToken.ExpiresAt) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "reset token is invalid or has expired"}`)
+		return
+	}
+
+	// Set the password and use up every outstanding reset token
+	err = qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		ID:             resetToken.UserID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to update password: %v"}`, err)
+		return
+	}
+	err = qtx.UsePasswordResetTokens(r.Context(), resetToken.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to use reset token: %v"}`, err)
+		return
+	}
+
+	// Sign out every session, whoever had the old password is locked out
+	err = qtx.RevokeSessions(r.Context(), database.RevokeSessionsParams{
+		UserID: resetToken.UserID,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to revoke sessions: %v"}`, err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to commit transaction: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/evanwiseman/chirpy/internal/entities"
+	"github.com/evanwiseman/chirpy/internal/models"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxAvatarURLLength   = 2048
+)
+
+// validateProfile checks the free-form profile fields, an empty value
+// clears the field
+func validateProfile(displayName, bio, avatarURL string) error {
+	if utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+		return fmt.Errorf("display name is longer than %d characters", maxDisplayNameLength)
+	}
+	if utf8.RuneCountInString(bio) > maxBioLength {
+		return fmt.Errorf("bio is longer than %d characters", maxBioLength)
+	}
+	if avatarURL == "" {
+		return nil
+	}
+	if len(avatarURL) > maxAvatarURLLength {
+		return fmt.Errorf("avatar url is longer than %d characters", maxAvatarURLLength)
+	}
+	u, err := url.Parse(avatarURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("avatar url must be an absolute http or https url")
+	}
+	return nil
+}
+
+func (cfg *APIConfig) HandlerPatchProfile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't get bearer token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	userID, err := cfg.authenticate(r.Context(), token, auth.ScopeProfileWrite)
+	if err != nil {
+		w.WriteHeader(authStatus(err))
+		fmt.Fprintf(w, `{"error": "couldn't validate jwt: %v"}`, err)
+		return
+	}
+
+	// Decode the parameters, omitted fields are left unchanged
+	decoder := json.NewDecoder(r.Body)
+	params := struct {
+		Handle      *string `json:"handle"`
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+		AvatarURL   *string `json:"avatar_url"`
+	}{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid format: %v"}`, err)
+		return
+	}
+
+	// Get the current profile
+	user, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "unable to get user: %v"}`, err)
+		return
+	}
+
+	// Merge in the changes
+	update := database.UpdateUserProfileParams{
+		ID:          user.ID,
+		Handle:      user.Handle,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarUrl:   user.AvatarUrl,
+	}
+	if params.Handle != nil {
+		if *params.Handle == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"error": "invalid handle: handle can't be removed"}`)
+			return
+		}
+		update.Handle, err = parseHandle(*params.Handle)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"error": "invalid handle: %v"}`, err)
+			return
+		}
+	}
+	if params.DisplayName != nil {
+		update.DisplayName = strings.TrimSpace(*params.DisplayName)
+	}
+	if params.Bio != nil {
+		update.Bio = strings.TrimSpace(*params.Bio)
+	}
+	if params.AvatarURL != nil {
+		update.AvatarUrl = strings.TrimSpace(*params.AvatarURL)
+	}
+	err = validateProfile(update.DisplayName, update.Bio, update.AvatarUrl)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid profile: %v"}`, err)
+		return
+	}
+
+	// Update the profile
+	user, err = cfg.DB.UpdateUserProfile(r.Context(), update)
+	if isUniqueViolation(err) {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, `{"error": "handle is already taken"}`)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to update profile: %v"}`, err)
+		return
+	}
+
+	// Pack response
+	data, err := json.Marshal(models.FormatUser(user, "", ""))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (cfg *APIConfig) HandlerGetProfile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Parse the handle
+	handle := entities.NormalizeHandle(r.PathValue("handle"))
+	if !entities.ValidHandle(handle) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "no user with handle '%v'"}`, handle)
+		return
+	}
+
+	// Get the profile
+	profile, err := cfg.DB.GetUserProfileByHandle(r.Context(), sql.NullString{String: handle, Valid: true})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "no user with handle '%v'"}`, handle)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to get profile: %v"}`, err)
+		return
+	}
+
+	// Pack response
+	data, err := json.Marshal(models.FormatProfile(profile))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/evanwiseman/chirpy/internal/models"
+	"github.com/evanwiseman/chirpy/internal/pagination"
+	"github.com/evanwiseman/chirpy/internal/search"
+	"github.com/google/uuid"
+)
+
+func searchKey(row database.SearchChirpsAscRow) pagination.Cursor {
+	return pagination.Cursor{Score: row.Rank, CreatedAt: row.Chirp.CreatedAt, ID: row.Chirp.ID}
+}
+
+func (cfg *APIConfig) HandlerSearchChirps(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Parse the search
+	query, err := search.Parse(r.URL.Query().Get("q"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid search: %v"}`, err)
+		return
+	}
+
+	// Parse the page size and cursor, results are always ranked by relevance
+	page, err := pagination.ParseQuery(r.URL.Query(), pagination.SortTop)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid page: %v"}`, err)
+		return
+	}
+	if page.Sort != pagination.SortTop {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid page: search results can only be sorted by top"}`)
+		return
+	}
+
+	// Fetch one extra row to find out if there is another page
+	params := database.SearchChirpsAscParams{
+		Query: query.TSQuery,
+		Since: sql.NullTime{Time: query.Since, Valid: !query.Since.IsZero()},
+		Until: sql.NullTime{Time: query.Until, Valid: !query.Until.IsZero()},
+		Limit: int32(page.Limit + 1),
+	}
+	if page.Cursor != nil {
+		params.CursorRank = sql.NullInt64{Int64: page.Cursor.Score, Valid: true}
+		params.CursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	// Resolve the author, an unknown handle matches nothing
+	authorFound := true
+	if query.From != "" {
+		users, err := cfg.DB.GetUsersByHandles(r.Context(), []string{query.From})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "unable to get author: %v"}`, err)
+			return
+		}
+		authorFound = len(users) > 0
+		if authorFound {
+			params.AuthorID = uuid.NullUUID{UUID: users[0].ID, Valid: true}
+		}
+	}
+
+	var rows []database.SearchChirpsAscRow
+	if authorFound {
+		if pagination.Ascending(page.Sort, page.Cursor) {
+			rows, err = cfg.DB.SearchChirpsAsc(r.Context(), params)
+		} else {
+			var descRows []database.SearchChirpsDescRow
+			descRows, err = cfg.DB.SearchChirpsDesc(r.Context(), database.SearchChirpsDescParams(params))
+			for _, row := range descRows {
+				rows = append(rows, database.SearchChirpsAscRow(row))
+			}
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "unable to search chirps: %v"}`, err)
+			return
+		}
+	}
+
+	rows, next, prev := pagination.Paginate(rows, page.Limit, page.Sort, page.Cursor, searchKey)
+
+	// Format a response
+	dbChirps := make([]database.Chirp, len(rows))
+	for i, row := range rows {
+		dbChirps[i] = row.Chirp
+	}
+	chirps, err := cfg.formatChirps(r.Context(), cfg.viewerID(r), dbChirps)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to format chirps: %v"}`, err)
+		return
+	}
+	for i := range chirps {
+		chirps[i].Snippet = search.Highlight(rows[i].Snippet)
+	}
+	resp := models.Page[models.Chirp]{
+		Data: chirps,
+		Next: next,
+		Prev: prev,
+	}
+
+	// Pack response
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	if link := pagination.LinkHeader(r.URL, next, prev); link != "" {
+		w.Header().Set("Link", link)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/models"
+)
+
+// sessionCookiePath limits the token cookies to the API, pages and the
+// OAuth endpoints never see them
+const sessionCookiePath = "/api/"
+
+// setSessionCookies stores a browser session's tokens in cookies scripts
+// can't read, along with the CSRF token scripts must send back
+func setSessionCookies(w http.ResponseWriter, token, refreshToken, csrfToken string) {
+	refreshMaxAge := refreshExpirationInDays * 24 * 60 * 60
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.AccessTokenCookie,
+		Value:    token,
+		Path:     sessionCookiePath,
+		MaxAge:   jwtExpirationInSeconds,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.RefreshTokenCookie,
+		Value:    refreshToken,
+		Path:     sessionCookiePath,
+		MaxAge:   refreshMaxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.CSRFTokenCookie,
+		Value:    csrfToken,
+		Path:     "/",
+		MaxAge:   refreshMaxAge,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// clearSessionCookies removes a browser session's cookies
+func clearSessionCookies(w http.ResponseWriter) {
+	for _, cookie := range []struct{ name, path string }{
+		{auth.AccessTokenCookie, sessionCookiePath},
+		{auth.RefreshTokenCookie, sessionCookiePath},
+		{auth.CSRFTokenCookie, "/"},
+	} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     cookie.name,
+			Path:     cookie.path,
+			MaxAge:   -1,
+			Secure:   true,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+}
+
+// useSessionCookies moves a new session's tokens out of resp and into
+// cookies, for browsers that shouldn't keep them in JavaScript storage.
+// resp gets the session's CSRF token instead.
+func useSessionCookies(w http.ResponseWriter, resp *models.User) error {
+	csrfToken, err := auth.MakeToken()
+	if err != nil {
+		return err
+	}
+	setSessionCookies(w, resp.Token, resp.RefreshToken, csrfToken)
+	resp.Token, resp.RefreshToken, resp.CSRFToken = "", "", csrfToken
+	return nil
+}
+
+// MiddlewareCSRF rejects state-changing API requests authenticated by
+// session cookies unless they send back the session's CSRF token. Requests
+// with an Authorization header can't be forged by other sites, so they
+// don't need it.
+func (cfg *APIConfig) MiddlewareCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, sessionCookiePath) ||
+			r.Header.Get("Authorization") != "" ||
+			!auth.HasSessionCookie(r.Header) ||
+			auth.ValidCSRFToken(r.Header) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, `{"error": "missing or invalid %s header"}`, auth.CSRFTokenHeader)
+	})
+}
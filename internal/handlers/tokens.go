@@ -1,50 +1,148 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/google/uuid"
 )
 
+// createRefreshToken stores a new refresh token in familyID, recording the
+// client that asked for it. Every token rotated from the one handed out at
+// login shares its family, which is the login session.
+func createRefreshToken(r *http.Request, db *database.Queries, userID, familyID uuid.UUID) (string, error) {
+	return createClientRefreshToken(r, db, userID, familyID, uuid.NullUUID{}, nil)
+}
+
+// createClientRefreshToken is createRefreshToken for a token issued to an
+// OAuth client, which may only be used within scopes
+func createClientRefreshToken(r *http.Request, db *database.Queries, userID, familyID uuid.UUID, clientID uuid.NullUUID, scopes []string) (string, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	expiresIn := time.Duration(refreshExpirationInDays) * time.Hour * 24
+	_, err = db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:     refreshToken,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(expiresIn),
+		FamilyID:  familyID,
+		UserAgent: r.UserAgent(),
+		Ip:        clientIP(r),
+		ClientID:  clientID,
+		Scopes:    scopes,
+	})
+	if err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+// rotateRefreshToken replaces old, which db should hold locked, with a new
+// token in the same family for the same client and scopes
+func rotateRefreshToken(r *http.Request, db *database.Queries, old database.RefreshToken) (string, error) {
+	newRefreshToken, err := createClientRefreshToken(r, db, old.UserID, old.FamilyID, old.ClientID, old.Scopes)
+	if err != nil {
+		return "", err
+	}
+	err = db.RotateRefreshToken(r.Context(), database.RotateRefreshTokenParams{
+		Token:      old.Token,
+		ReplacedBy: sql.NullString{String: newRefreshToken, Valid: true},
+	})
+	if err != nil {
+		return "", err
+	}
+	return newRefreshToken, nil
+}
+
 func (cfg *APIConfig) HandlerRefresh(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get the refresh token
-	refreshToken, err := auth.GetBearerToken(r.Header)
+	// Get the refresh token, browser sessions send it in a cookie
+	refreshToken, err := auth.GetRefreshToken(r.Header)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, `{"error": "invalid header: %v}`, err)
 		return
 	}
+	useCookies := r.Header.Get("Authorization") == ""
+
+	// Lock the refresh token so concurrent refreshes rotate it only once
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to begin transaction: %v"}`, err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
 
 	// Find the refresh token in the database
-	dbRefreshToken, err := cfg.DB.GetRefreshToken(r.Context(), refreshToken)
+	dbRefreshToken, err := qtx.GetRefreshTokenForUpdate(r.Context(), refreshToken)
 	// Token doesn't exist
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		fmt.Fprintf(w, `{"error": "unauthorized access, token doesn't exist: %v"}`, err)
 		return
 	}
-	// Token has expired
-	if time.Now().Compare(dbRefreshToken.ExpiresAt) > 0 {
+	// Token belongs to an OAuth client, which refreshes at /oauth/token
+	if dbRefreshToken.ClientID.Valid {
 		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprintf(w, `{"error": "unauthorized access, token has expired: %v"}`, err)
+		fmt.Fprintf(w, `{"error": "unauthorized access, token was issued to an oauth client"}`)
+		return
+	}
+	// Token was already rotated, someone is replaying it so end the session
+	if dbRefreshToken.ReplacedBy.Valid {
+		err = qtx.RevokeRefreshTokenFamily(r.Context(), dbRefreshToken.FamilyID)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "unable to revoke reused token family: %v"}`, err)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "unauthorized access, token has already been used"}`)
 		return
 	}
 	// Token is revoked
-	if dbRefreshToken.RevokedAt.Valid && time.Now().Compare(dbRefreshToken.RevokedAt.Time) > 0 {
+	if dbRefreshToken.RevokedAt.Valid {
 		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprintf(w, `{"error": "unauthorized access, token has been revoked: %v"}`, err)
+		fmt.Fprintf(w, `{"error": "unauthorized access, token has been revoked"}`)
+		return
+	}
+	// Token has expired
+	if time.Now().After(dbRefreshToken.ExpiresAt) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "unauthorized access, token has expired"}`)
+		return
+	}
+
+	// Rotate the refresh token
+	newRefreshToken, err := rotateRefreshToken(r, qtx, dbRefreshToken)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "couldn't rotate refresh token: %v"}`, err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to commit transaction: %v"}`, err)
 		return
 	}
 
-	// Get the expiration duration
-	expiresAt := dbRefreshToken.ExpiresAt.Sub(dbRefreshToken.CreatedAt)
 	// Generate a new access token
-	token, err := auth.MakeJWT(dbRefreshToken.UserID, cfg.JWTSecret, expiresAt)
+	expiresIn := time.Duration(jwtExpirationInSeconds) * time.Second
+	token, err := auth.MakeSessionJWT(dbRefreshToken.UserID, dbRefreshToken.FamilyID, cfg.Keys, expiresIn)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(w, `{"error": "unable to get access token: %v"}`, err)
@@ -52,9 +150,30 @@ func (cfg *APIConfig) HandlerRefresh(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp := struct {
-		Token string `json:"token"`
+		Token        string `json:"token,omitempty"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+		CSRFToken    string `json:"csrf_token,omitempty"`
 	}{
-		Token: token,
+		Token:        token,
+		RefreshToken: newRefreshToken,
+	}
+
+	// Browser sessions keep their tokens, and CSRF token, in cookies
+	if useCookies {
+		csrfToken := ""
+		if cookie, err := r.Cookie(auth.CSRFTokenCookie); err == nil {
+			csrfToken = cookie.Value
+		}
+		if csrfToken == "" {
+			csrfToken, err = auth.MakeToken()
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, `{"error": "couldn't generate csrf token: %v"}`, err)
+				return
+			}
+		}
+		setSessionCookies(w, token, newRefreshToken, csrfToken)
+		resp.Token, resp.RefreshToken, resp.CSRFToken = "", "", csrfToken
 	}
 
 	// Pack response
@@ -72,8 +191,8 @@ func (cfg *APIConfig) HandlerRefresh(w http.ResponseWriter, r *http.Request) {
 func (cfg *APIConfig) HandlerRevoke(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get the refresh token
-	refreshToken, err := auth.GetBearerToken(r.Header)
+	// Get the refresh token, browser sessions send it in a cookie
+	refreshToken, err := auth.GetRefreshToken(r.Header)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, `{"error": "invalid header: %v}`, err)
@@ -88,5 +207,52 @@ func (cfg *APIConfig) HandlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *APIConfig) HandlerLogout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't get bearer token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	accessToken, err := auth.ParseAccessToken(token, cfg.Keys)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't validate jwt: %v"}`, err)
+		return
+	}
+
+	// Revoke the session's refresh token
+	if accessToken.SessionID != uuid.Nil {
+		_, err = cfg.DB.RevokeSession(r.Context(), database.RevokeSessionParams{
+			UserID:   accessToken.UserID,
+			FamilyID: accessToken.SessionID,
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "unable to revoke session: %v"}`, err)
+			return
+		}
+	}
+
+	// Revoke the access token itself
+	if accessToken.ID != "" {
+		err = cfg.RevokedTokens.Revoke(r.Context(), accessToken.ID, accessToken.UserID, accessToken.ExpiresAt)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "unable to revoke access token: %v"}`, err)
+			return
+		}
+	}
+
+	clearSessionCookies(w)
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	mfaTokenExpirationInMinutes = 5
+	recoveryCodeCount           = 10
+)
+
+// writeMFAChallenge responds to a correct password with a token to be sent
+// back to /api/login/mfa along with the second factor
+func (cfg *APIConfig) writeMFAChallenge(w http.ResponseWriter, userID uuid.UUID) {
+	mfaToken, err := auth.MakeMFAToken(userID, cfg.Keys, mfaTokenExpirationInMinutes*time.Minute)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "couldn't generate mfa token: %v"}`, err)
+		return
+	}
+
+	resp := struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+	}
+
+	// Pack response
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// checkSecondFactor reports whether code is the user's current
+// authenticator code, or else whether recoveryCode is one of their unused
+// recovery codes, and uses it up. db should hold credential locked so a
+// code can only be used once.
+func checkSecondFactor(ctx context.Context, db *database.Queries, credential database.TotpCredential, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := auth.ValidateTOTP(code, credential.Secret, time.Now(), credential.LastUsedStep)
+		if !ok {
+			return false, nil
+		}
+		err := db.UseTOTPStep(ctx, database.UseTOTPStepParams{
+			UserID:       credential.UserID,
+			LastUsedStep: step,
+		})
+		return err == nil, err
+	}
+	if recoveryCode == "" {
+		return false, nil
+	}
+
+	recoveryCodes, err := db.GetUnusedRecoveryCodes(ctx, credential.UserID)
+	if err != nil {
+		return false, err
+	}
+	recoveryCode = auth.NormalizeRecoveryCode(recoveryCode)
+	for _, c := range recoveryCodes {
+		ok, err := auth.CheckPasswordHash(recoveryCode, c.CodeHash)
+		if err != nil || !ok {
+			continue
+		}
+		rows, err := db.UseRecoveryCode(ctx, c.ID)
+		return rows == 1, err
+	}
+	return false, nil
+}
+
+func (cfg *APIConfig) HandlerEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't get bearer token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	userID, err := auth.ValidateJWT(token, cfg.Keys)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't validate jwt: %v"}`, err)
+		return
+	}
+
+	// Get the user to label the key with
+	user, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "unable to get user: %v"}`, err)
+		return
+	}
+
+	// Generate a secret, replacing any enrollment that was never confirmed
+	key, err := auth.GenerateTOTPKey(user.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "%v"}`, err)
+		return
+	}
+	rows, err := cfg.DB.StartTOTPEnrollment(r.Context(), database.StartTOTPEnrollmentParams{
+		UserID: userID,
+		Secret: key.Secret,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to save totp secret: %v"}`, err)
+		return
+	}
+	if rows == 0 {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, `{"error": "two-factor authentication is already enabled"}`)
+		return
+	}
+
+	resp := struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+		QRCodePNG  string `json:"qr_code_png"`
+	}{
+		Secret:     key.Secret,
+		OTPAuthURI: key.URI,
+		QRCodePNG:  base64.StdEncoding.EncodeToString(key.QRCode),
+	}
+
+	// Pack response
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(data)
+}
+
+func (cfg *APIConfig) HandlerConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't get bearer token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	userID, err := auth.ValidateJWT(token, cfg.Keys)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't validate jwt: %v"}`, err)
+		return
+	}
+
+	// Decode the body into params
+	decoder := json.NewDecoder(r.Body)
+	params := struct {
+		Code string `json:"code"`
+	}{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid format: %v"}`, err)
+		return
+	}
+
+	// Generate the recovery codes up front, hashing them is slow
+	codes, err := auth.MakeRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "couldn't generate recovery codes: %v"}`, err)
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i], err = auth.HashPassword(code)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "%v"}`, err)
+			return
+		}
+	}
+
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to begin transaction: %v"}`, err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	// Get the pending enrollment
+	credential, err := qtx.GetTOTPCredentialForUpdate(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "two-factor enrollment hasn't been started"}`)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to get totp secret: %v"}`, err)
+		return
+	}
+	if credential.ConfirmedAt.Valid {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, `{"error": "two-factor authentication is already enabled"}`)
+		return
+	}
+
+	// A code from the authenticator proves it holds the secret
+	step, ok := auth.ValidateTOTP(params.Code, credential.Secret, time.Now(), credential.LastUsedStep)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid code"}`)
+		return
+	}
+	err = qtx.ConfirmTOTPCredential(r.Context(), database.ConfirmTOTPCredentialParams{
+		UserID:       userID,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to enable two-factor authentication: %v"}`, err)
+		return
+	}
+
+	// Store the recovery codes hashed, they are only shown this once
+	err = qtx.DeleteRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to delete recovery codes: %v"}`, err)
+		return
+	}
+	for _, hash := range hashes {
+		err = qtx.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: hash,
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "unable to create recovery code: %v"}`, err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to commit transaction: %v"}`, err)
+		return
+	}
+
+	resp := struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{
+		RecoveryCodes: codes,
+	}
+
+	// Pack response
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (cfg *APIConfig) HandlerLoginMFA(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Decode the body into params
+	decoder := json.NewDecoder(r.Body)
+	params := struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+		UseCookies   bool   `json:"use_cookies"`
+	}{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid format: %v"}`, err)
+		return
+	}
+
+	// Validate the challenge from /api/login
+	userID, err := auth.ValidateMFAToken(params.MFAToken, cfg.Keys)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "invalid mfa token: %v"}`, err)
+		return
+	}
+
+	// Wrong codes count against the account like wrong passwords
+	user, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "unable to get user: %v"}`, err)
+		return
+	}
+	ip := clientIP(r)
+	retryAt, err := cfg.LoginLimiter.Attempt(r.Context(), user.Email, ip)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to check login attempts: %v"}`, err)
+		return
+	}
+	if !retryAt.IsZero() {
+		writeLockedOut(w, retryAt)
+		return
+	}
+
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to begin transaction: %v"}`, err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	// Lock the credential so a code can only be used once
+	credential, err := qtx.GetTOTPCredentialForUpdate(r.Context(), userID)
+	if err != nil || !credential.ConfirmedAt.Valid {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "two-factor authentication isn't enabled"}`)
+		return
+	}
+
+	// Check the authenticator code, or else a recovery code
+	verified, err := checkSecondFactor(r.Context(), qtx, credential, params.Code, params.RecoveryCode)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to check code: %v"}`, err)
+		return
+	}
+	if !verified {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "invalid code"}`)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to commit transaction: %v"}`, err)
+		return
+	}
+	err = cfg.LoginLimiter.Succeed(r.Context(), user.Email, ip)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to record login attempt: %v"}`, err)
+		return
+	}
+
+	// Start a new session
+	resp, err := cfg.startSession(r, user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "couldn't start session: %v"}`, err)
+		return
+	}
+
+	// Browsers can keep the session in cookies instead of JavaScript storage
+	if params.UseCookies {
+		err = useSessionCookies(w, &resp)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "couldn't set session cookies: %v"}`, err)
+			return
+		}
+	}
+
+	// Pack response
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -1,21 +1,84 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/mail"
+	"strings"
 	"time"
 
 	"github.com/evanwiseman/chirpy/internal/auth"
 	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/evanwiseman/chirpy/internal/entities"
 	"github.com/evanwiseman/chirpy/internal/models"
+	"github.com/evanwiseman/chirpy/internal/passwords"
+	"github.com/google/uuid"
 )
 
 const (
 	jwtExpirationInSeconds  = 3600
 	refreshExpirationInDays = 60
+	maxEmailLength          = 254
 )
 
+// parseEmail checks that s is a bare address such as gopher@example.com,
+// without a display name or angle brackets, and returns it in lower case so
+// an address can only belong to one account
+func parseEmail(s string) (string, error) {
+	email := strings.ToLower(strings.TrimSpace(s))
+	if email == "" {
+		return "", fmt.Errorf("email is required")
+	}
+	if len(email) > maxEmailLength {
+		return "", fmt.Errorf("email is longer than %d characters", maxEmailLength)
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return "", fmt.Errorf("%q is not an email address", email)
+	}
+	domain := email[strings.LastIndex(email, "@")+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", fmt.Errorf("%q is not an email address", email)
+	}
+	return email, nil
+}
+
+// parseHandle validates an optional handle, returning it in canonical form
+func parseHandle(s string) (sql.NullString, error) {
+	if s == "" {
+		return sql.NullString{}, nil
+	}
+	handle := strings.TrimPrefix(s, "@")
+	if !entities.ValidHandle(handle) {
+		return sql.NullString{}, fmt.Errorf("handles are 1-15 letters, digits or underscores")
+	}
+	if entities.ReservedHandle(handle) {
+		return sql.NullString{}, fmt.Errorf("handle %q is reserved", handle)
+	}
+	return sql.NullString{String: entities.NormalizeHandle(handle), Valid: true}, nil
+}
+
+// startSession signs the user in on a new session with a refresh token
+// family of its own, returning them with their access and refresh tokens
+func (cfg *APIConfig) startSession(r *http.Request, user database.User) (models.User, error) {
+	sessionID := uuid.New()
+	refreshToken, err := createRefreshToken(r, cfg.DB, user.ID, sessionID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("couldn't create refresh token in database: %v", err)
+	}
+
+	expiresIn := time.Duration(jwtExpirationInSeconds) * time.Second
+	token, err := auth.MakeSessionJWT(user.ID, sessionID, cfg.Keys, expiresIn)
+	if err != nil {
+		return models.User{}, fmt.Errorf("couldn't generate jwt token: %v", err)
+	}
+
+	return models.FormatUser(user, token, refreshToken), nil
+}
+
 func (cfg *APIConfig) HandlerPostUsers(w http.ResponseWriter, r *http.Request) {
 	// Set the header
 	w.Header().Set("Content-Type", "application/json")
@@ -25,6 +88,7 @@ func (cfg *APIConfig) HandlerPostUsers(w http.ResponseWriter, r *http.Request) {
 	params := struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Handle   string `json:"handle"`
 	}{}
 	err := decoder.Decode(&params)
 	if err != nil {
@@ -33,6 +97,35 @@ func (cfg *APIConfig) HandlerPostUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Validate the email
+	email, err := parseEmail(params.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid email: %v"}`, err)
+		return
+	}
+
+	// Validate the optional handle
+	handle, err := parseHandle(params.Handle)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid handle: %v"}`, err)
+		return
+	}
+
+	// Make sure the password is strong enough
+	err = cfg.PasswordPolicy.Check(params.Password)
+	if errors.Is(err, passwords.ErrWeakPassword) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "%v"}`, err)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to check password: %v"}`, err)
+		return
+	}
+
 	// Hash the password
 	hashed_password, err := auth.HashPassword(params.Password)
 	if err != nil {
@@ -41,17 +134,48 @@ func (cfg *APIConfig) HandlerPostUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to begin transaction: %v"}`, err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
 	// Create a user in the database with the email
-	user, err := cfg.DB.CreateUser(r.Context(), database.CreateUserParams{
-		Email:          params.Email,
+	user, err := qtx.CreateUser(r.Context(), database.CreateUserParams{
+		Email:          email,
 		HashedPassword: hashed_password,
+		Handle:         handle,
 	})
+	if isUniqueViolation(err) {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, `{"error": "email or handle is already taken"}`)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(w, `{"error": "unable to create user: %v"}`, err)
 		return
 	}
 
+	// Create a token to confirm the email with
+	verificationToken, err := createVerificationToken(r.Context(), qtx, user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "couldn't create verification token: %v"}`, err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to commit transaction: %v"}`, err)
+		return
+	}
+	cfg.sendVerificationMail(user.Email, verificationToken)
+
 	// Format the response
 	resp := models.FormatUser(user, "", "")
 
@@ -79,7 +203,7 @@ func (cfg *APIConfig) HandlerPutUsers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate the access token
-	userID, err := auth.ValidateJWT(token, cfg.JWTSecret)
+	userID, sessionID, err := auth.ValidateSessionJWT(token, cfg.Keys)
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		fmt.Fprintf(w, `{"error": "invalid access token: %v"}`, err)
@@ -91,6 +215,7 @@ func (cfg *APIConfig) HandlerPutUsers(w http.ResponseWriter, r *http.Request) {
 	params := struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Handle   string `json:"handle"`
 	}{}
 	err = decoder.Decode(&params)
 	if err != nil {
@@ -99,23 +224,124 @@ func (cfg *APIConfig) HandlerPutUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Hash the password
-	hashedPassword, err := auth.HashPassword(params.Password)
+	// Validate the email
+	email, err := parseEmail(params.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid email: %v"}`, err)
+		return
+	}
+
+	// Validate the optional handle, leaving it unchanged when omitted
+	handle, err := parseHandle(params.Handle)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid handle: %v"}`, err)
+		return
+	}
+
+	if params.Password == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "password is required"}`)
+		return
+	}
+
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, `{"error": "failed to hash password: %v"}`, err)
+		fmt.Fprintf(w, `{"error": "unable to begin transaction: %v"}`, err)
 		return
 	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	// Find out if the password is changing
+	oldUser, err := qtx.GetUser(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "unable to get user: %v"}`, err)
+		return
+	}
+	samePassword, err := auth.CheckPasswordHash(params.Password, oldUser.HashedPassword)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "hashing failed: %v"}`, err)
+		return
+	}
+
+	// A new password must be strong enough before it is hashed, an old one
+	// is kept as it is
+	hashedPassword := oldUser.HashedPassword
+	if !samePassword {
+		err = cfg.PasswordPolicy.Check(params.Password)
+		if errors.Is(err, passwords.ErrWeakPassword) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"error": "%v"}`, err)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "unable to check password: %v"}`, err)
+			return
+		}
+		hashedPassword, err = auth.HashPassword(params.Password)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "failed to hash password: %v"}`, err)
+			return
+		}
+	}
 
 	// Update the user with the provided information
-	newUser, err := cfg.DB.UpdateUser(r.Context(), database.UpdateUserParams{
+	newUser, err := qtx.UpdateUser(r.Context(), database.UpdateUserParams{
 		ID:             userID,
-		Email:          params.Email,
+		Email:          email,
 		HashedPassword: hashedPassword,
+		Handle:         handle,
 	})
+	if isUniqueViolation(err) {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, `{"error": "email or handle is already taken"}`)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(w, `{"error": "unable to update user: %v"}`, err)
+		return
+	}
+
+	// A new password signs out every other session
+	if !samePassword {
+		err = qtx.RevokeSessions(r.Context(), database.RevokeSessionsParams{
+			UserID:         userID,
+			ExceptFamilyID: uuid.NullUUID{UUID: sessionID, Valid: sessionID != uuid.Nil},
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "unable to revoke sessions: %v"}`, err)
+			return
+		}
+	}
+
+	// A new email has to be confirmed again
+	var verificationToken string
+	if newUser.Email != oldUser.Email {
+		verificationToken, err = createVerificationToken(r.Context(), qtx, newUser)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "couldn't create verification token: %v"}`, err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to commit transaction: %v"}`, err)
+		return
+	}
+	if verificationToken != "" {
+		cfg.sendVerificationMail(newUser.Email, verificationToken)
 	}
 
 	// Format a response
@@ -139,8 +365,9 @@ func (cfg *APIConfig) HandlerLogin(w http.ResponseWriter, r *http.Request) {
 	// Decode the body into params
 	decoder := json.NewDecoder(r.Body)
 	params := struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		UseCookies bool   `json:"use_cookies"`
 	}{}
 	err := decoder.Decode(&params)
 	if err != nil {
@@ -149,59 +376,54 @@ func (cfg *APIConfig) HandlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Find a dbUser with the specified email
-	dbUser, err := cfg.DB.GetUserByEmail(r.Context(), params.Email)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprintf(w, `{"error": "unable to validate credentials, invalid email: %v"}`, err)
-		return
-	}
-
 	// Validate their credentials
-	ok, err := auth.CheckPasswordHash(params.Password, dbUser.HashedPassword)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, `{"error": "hashing failed: %v"}`, err)
+	dbUser, err := cfg.checkPassword(r, params.Email, params.Password)
+	var lockedOut *lockedOutError
+	if errors.As(err, &lockedOut) {
+		writeLockedOut(w, lockedOut.retryAt)
 		return
 	}
-	if !ok {
+	if errors.Is(err, errInvalidCredentials) {
 		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprintf(w, `{"error": "unable to validate credentials, invalid password: %v"}`, err)
+		fmt.Fprintf(w, `{"error": "invalid email or password"}`)
 		return
 	}
-
-	// Generate access token
-	expiresAt := time.Duration(jwtExpirationInSeconds) * time.Second
-	jwtToken, err := auth.MakeJWT(dbUser.ID, cfg.JWTSecret, expiresAt)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, `{"error": "couldn't generate jwt token: %v"}`, err)
+		fmt.Fprintf(w, `{"error": "unable to check credentials: %v"}`, err)
 		return
 	}
 
-	// Generate a refresh token
-	refreshToken, err := auth.MakeRefreshToken()
-	if err != nil {
+	// With two-factor authentication on, the password only earns a
+	// challenge to be answered at /api/login/mfa
+	totpCredential, err := cfg.DB.GetTOTPCredential(r.Context(), dbUser.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, `{"error": "couldn't generate refresh token %v"}`, err)
+		fmt.Fprintf(w, `{"error": "unable to get two-factor settings: %v"}`, err)
+		return
+	}
+	if err == nil && totpCredential.ConfirmedAt.Valid {
+		cfg.writeMFAChallenge(w, dbUser.ID)
 		return
 	}
 
-	// Add refresh token to database
-	expiresAt = time.Duration(refreshExpirationInDays) * time.Hour * 24
-	_, err = cfg.DB.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:     refreshToken,
-		UserID:    dbUser.ID,
-		ExpiresAt: time.Now().Add(expiresAt),
-	})
+	// Start a new session
+	resp, err := cfg.startSession(r, dbUser)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, `{"error": "couldn't create refresh token in database: %v}`, err)
+		fmt.Fprintf(w, `{"error": "couldn't start session: %v"}`, err)
 		return
 	}
 
-	// Format a response
-	resp := models.FormatUser(dbUser, jwtToken, refreshToken)
+	// Browsers can keep the session in cookies instead of JavaScript storage
+	if params.UseCookies {
+		err = useSessionCookies(w, &resp)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "couldn't set session cookies: %v"}`, err)
+			return
+		}
+	}
 
 	// Pack response
 	data, err := json.Marshal(resp)
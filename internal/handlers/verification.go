@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/evanwiseman/chirpy/internal/mail"
+	"github.com/evanwiseman/chirpy/internal/models"
+	"github.com/google/uuid"
+)
+
+const verificationTokenExpirationInHours = 24
+
+// createVerificationToken stores a token that confirms the user owns their
+// current email, only its hash is stored
+func createVerificationToken(ctx context.Context, db *database.Queries, user database.User) (string, error) {
+	token, err := auth.MakeToken()
+	if err != nil {
+		return "", err
+	}
+	err = db.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(verificationTokenExpirationInHours * time.Hour),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (cfg *APIConfig) sendVerificationMail(to, token string) {
+	cfg.sendMail(mail.Message{
+		To:      to,
+		Subject: "Confirm your Chirpy email",
+		Body: fmt.Sprintf("Confirm this is your email address by sending the token below to /api/users/verify:\n\n%s\n\n"+
+			"It expires in %d hours. If you didn't sign up for Chirpy you can ignore this email.\n",
+			token, verificationTokenExpirationInHours),
+	})
+}
+
+// canPost reports whether a user may post chirps, when verified emails are
+// required that means they have confirmed theirs
+func (cfg *APIConfig) canPost(ctx context.Context, userID uuid.UUID) (bool, error) {
+	if !cfg.RequireVerifiedEmail {
+		return true, nil
+	}
+	user, err := cfg.DB.GetUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return user.EmailVerifiedAt.Valid, nil
+}
+
+func (cfg *APIConfig) HandlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Decode the body into params
+	decoder := json.NewDecoder(r.Body)
+	params := struct {
+		Token string `json:"token"`
+	}{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "invalid format: %v"}`, err)
+		return
+	}
+
+	tx, err := cfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to begin transaction: %v"}`, err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	// Lock the verification token so it can only be used once
+	verification, err := qtx.GetEmailVerificationTokenForUpdate(r.Context(), auth.HashToken(params.Token))
+	if err != nil || verification.UsedAt.Valid || time.Now().After(verification.ExpiresAt) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "verification token is invalid or has expired"}`)
+		return
+	}
+
+	// Verify the email, a token sent to an address the user has since
+	// changed away from verifies nothing
+	user, err := qtx.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+		ID:    verification.UserID,
+		Email: verification.Email,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "verification token is invalid or has expired"}`)
+		return
+	}
+	err = qtx.UseEmailVerificationTokens(r.Context(), user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to use verification token: %v"}`, err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to commit transaction: %v"}`, err)
+		return
+	}
+
+	// Pack response
+	data, err := json.Marshal(models.FormatUser(user, "", ""))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "unable to marshal data: %v"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (cfg *APIConfig) HandlerResendVerification(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the access token
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't get bearer token: %v"}`, err)
+		return
+	}
+
+	// Validate the access token
+	userID, err := auth.ValidateJWT(token, cfg.Keys)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error": "couldn't validate jwt: %v"}`, err)
+		return
+	}
+
+	// Get the user
+	user, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": "unable to get user: %v"}`, err)
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, `{"error": "email is already verified"}`)
+		return
+	}
+
+	// Mail a new token
+	verificationToken, err := createVerificationToken(r.Context(), cfg.DB, user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "couldn't create verification token: %v"}`, err)
+		return
+	}
+	cfg.sendVerificationMail(user.Email, verificationToken)
+
+	w.WriteHeader(http.StatusAccepted)
+}
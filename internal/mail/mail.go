@@ -0,0 +1,128 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPMailer delivers email through an SMTP server. Username and Password
+// are optional, when set the server must support STARTTLS.
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// Send delivers msg, giving up once ctx is done
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	err := m.send(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("unable to send mail to %s: %v", msg.To, err)
+	}
+	return nil
+}
+
+// send is smtp.SendMail over a connection bound to ctx, so a server that
+// stops responding can't hold it forever
+func (m *SMTPMailer) send(ctx context.Context, msg Message) error {
+	host, _, _ := strings.Cut(m.Addr, ":")
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.Username, m.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(m.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return err
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := wc.Write(format(m.From, msg, time.Now())); err != nil {
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// LogMailer writes every message to Out instead of delivering it, for
+// development and tests
+type LogMailer struct {
+	From string
+	Out  io.Writer
+
+	mu sync.Mutex
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintf(m.Out, "%s\r\n", format(m.From, msg, time.Now()))
+	return err
+}
+
+// headerValue keeps user supplied values such as addresses from starting
+// a new header line
+var headerValue = strings.NewReplacer("\r", " ", "\n", " ")
+
+// format renders msg as an RFC 5322 message
+func format(from string, msg Message, date time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
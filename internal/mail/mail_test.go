@@ -0,0 +1,71 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	msg := Message{
+		To:      "user@example.com\r\nBcc: victim@example.com",
+		Subject: "Hello",
+		Body:    "line one\nline two\r\n",
+	}
+	got := string(format("chirpy@example.com", msg, time.Date(2025, 10, 2, 12, 0, 0, 0, time.UTC)))
+
+	if strings.Contains(got, "\r\nBcc:") {
+		t.Errorf("expected header injection to be neutralised:\n%s", got)
+	}
+	if !strings.Contains(got, "Subject: Hello\r\n") || !strings.Contains(got, "Date: Thu, 02 Oct 2025 12:00:00 +0000\r\n") {
+		t.Errorf("missing headers:\n%s", got)
+	}
+	if !strings.HasSuffix(got, "\r\n\r\nline one\r\nline two\r\n") {
+		t.Errorf("expected body with CRLF line endings:\n%q", got)
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	var out bytes.Buffer
+	m := &LogMailer{From: "chirpy@example.com", Out: &out}
+
+	err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Reset", Body: "token"})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "To: user@example.com") || !strings.Contains(out.String(), "token") {
+		t.Errorf("expected message to be logged, got %q", out.String())
+	}
+}
+
+func TestSMTPMailerStopsWithContext(t *testing.T) {
+	// A server that accepts connections but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	m := &SMTPMailer{Addr: ln.Addr().String(), From: "chirpy@example.com"}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := m.Send(ctx, Message{To: "user@example.com"}); err == nil {
+		t.Error("expected send to a silent server to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected send to stop with the context, took %v", elapsed)
+	}
+}
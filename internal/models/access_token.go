@@ -0,0 +1,41 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// PersonalAccessToken is a long-lived token for scripts and bots. Token is
+// only set in the response that creates it, afterwards just its hash is
+// kept.
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func FormatPersonalAccessToken(t database.PersonalAccessToken, token string) PersonalAccessToken {
+	return PersonalAccessToken{
+		ID:         t.ID,
+		Name:       t.Name,
+		Scopes:     t.Scopes,
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  formatNullTime(t.ExpiresAt),
+		LastUsedAt: formatNullTime(t.LastUsedAt),
+		Token:      token,
+	}
+}
+
+func formatNullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -8,19 +8,128 @@ import (
 )
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Body       string     `json:"body"`
+	UserID     uuid.UUID  `json:"user_id"`
+	InReplyTo  *uuid.UUID `json:"in_reply_to"`
+	RootID     *uuid.UUID `json:"root_id"`
+	ReplyCount int        `json:"reply_count"`
+	LikeCount  int        `json:"like_count"`
+	LikedByMe  bool       `json:"liked_by_me"`
+	QuoteOf    *ChirpRef  `json:"quote_of,omitempty"`
+	RechirpOf  *ChirpRef  `json:"rechirp_of,omitempty"`
+	Hashtags   []string   `json:"hashtags"`
+	Mentions   []Mention  `json:"mentions"`
+	Snippet    string     `json:"snippet,omitempty"`
 }
 
-func FormatChirp(c database.Chirp) Chirp {
+// Mention is an @handle in a chirp body resolved to a user. Offset and
+// Length count Unicode code points and include the '@'.
+type Mention struct {
+	Offset int       `json:"offset"`
+	Length int       `json:"length"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func FormatMention(m database.ChirpMention) Mention {
+	return Mention{
+		Offset: int(m.StartIndex),
+		Length: int(m.Length),
+		UserID: m.UserID,
+	}
+}
+
+// ChirpRef is a chirp embedded in a quote or rechirp. A deleted chirp is
+// left as a tombstone carrying only its id. Chirps are only embedded one
+// level deep, refs inside an embedded chirp carry just the id and no
+// Deleted, as whether they still exist isn't known.
+type ChirpRef struct {
+	ID      uuid.UUID `json:"id"`
+	Deleted *bool     `json:"deleted,omitempty"`
+	Chirp   *Chirp    `json:"chirp,omitempty"`
+}
+
+// FormatChirp formats a chirp, embedding the chirp it quotes or rechirps
+// from related. Referenced chirps missing from related have been deleted.
+func FormatChirp(c database.Chirp, related map[uuid.UUID]database.Chirp) Chirp {
+	chirp := formatChirp(c)
+	chirp.QuoteOf = formatChirpRef(c.QuoteOf, related)
+	chirp.RechirpOf = formatChirpRef(c.RechirpOf, related)
+	return chirp
+}
+
+// formatChirp formats a chirp with refs to the chirps it quotes or
+// rechirps, without embedding them
+func formatChirp(c database.Chirp) Chirp {
 	return Chirp{
-		ID:        c.ID,
-		CreatedAt: c.CreatedAt,
-		UpdatedAt: c.UpdatedAt,
-		Body:      c.Body,
-		UserID:    c.UserID,
+		ID:         c.ID,
+		CreatedAt:  c.CreatedAt,
+		UpdatedAt:  c.UpdatedAt,
+		Body:       c.Body,
+		UserID:     c.UserID,
+		InReplyTo:  formatNullUUID(c.InReplyTo),
+		RootID:     formatNullUUID(c.RootID),
+		ReplyCount: int(c.ReplyCount),
+		LikeCount:  int(c.LikeCount),
+		QuoteOf:    formatNestedChirpRef(c.QuoteOf),
+		RechirpOf:  formatNestedChirpRef(c.RechirpOf),
+		Hashtags:   []string{},
+		Mentions:   []Mention{},
+	}
+}
+
+func formatChirpRef(id uuid.NullUUID, related map[uuid.UUID]database.Chirp) *ChirpRef {
+	if !id.Valid {
+		return nil
+	}
+	c, ok := related[id.UUID]
+	deleted := !ok
+	if deleted {
+		return &ChirpRef{ID: id.UUID, Deleted: &deleted}
+	}
+	// Only embed one level deep
+	chirp := formatChirp(c)
+	return &ChirpRef{ID: id.UUID, Deleted: &deleted, Chirp: &chirp}
+}
+
+func formatNestedChirpRef(id uuid.NullUUID) *ChirpRef {
+	if !id.Valid {
+		return nil
+	}
+	return &ChirpRef{ID: id.UUID}
+}
+
+// ChirpThread is a chirp with the chain of chirps it replies to and a page
+// of the replies beneath it
+type ChirpThread struct {
+	Chirp     Chirp       `json:"chirp"`
+	Ancestors []Chirp     `json:"ancestors"`
+	Replies   Page[Chirp] `json:"replies"`
+}
+
+func formatNullUUID(u uuid.NullUUID) *uuid.UUID {
+	if !u.Valid {
+		return nil
+	}
+	return &u.UUID
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID `json:"id"`
+	ChirpID    uuid.UUID `json:"chirp_id"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+func FormatChirpRevision(r database.ChirpRevision) ChirpRevision {
+	return ChirpRevision{
+		ID:         r.ID,
+		ChirpID:    r.ChirpID,
+		Body:       r.Body,
+		CreatedAt:  r.CreatedAt,
+		ReplacedAt: r.ReplacedAt,
 	}
 }
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestFormatChirpQuoteOfQuote(t *testing.T) {
+	original := database.Chirp{ID: uuid.New(), Body: "original"}
+	quote := database.Chirp{ID: uuid.New(), Body: "quote", QuoteOf: uuid.NullUUID{UUID: original.ID, Valid: true}}
+	quoteOfQuote := database.Chirp{ID: uuid.New(), Body: "quote of quote", QuoteOf: uuid.NullUUID{UUID: quote.ID, Valid: true}}
+
+	chirp := FormatChirp(quoteOfQuote, map[uuid.UUID]database.Chirp{quote.ID: quote})
+	if chirp.QuoteOf == nil || chirp.QuoteOf.Chirp == nil {
+		t.Fatalf("expected quoted chirp to be embedded, got %+v", chirp.QuoteOf)
+	}
+	if chirp.QuoteOf.Deleted == nil || *chirp.QuoteOf.Deleted {
+		t.Errorf("expected quoted chirp not to be deleted")
+	}
+
+	// The quoted chirp's own quote is only referenced, not claimed deleted
+	nested := chirp.QuoteOf.Chirp.QuoteOf
+	if nested == nil || nested.ID != original.ID {
+		t.Fatalf("expected nested ref to %v, got %+v", original.ID, nested)
+	}
+	if nested.Deleted != nil || nested.Chirp != nil {
+		t.Errorf("expected nested ref to carry only its id, got %+v", nested)
+	}
+	data, err := json.Marshal(nested)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if expected := `{"id":"` + original.ID.String() + `"}`; string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+}
+
+func TestFormatChirpDeletedQuote(t *testing.T) {
+	quote := database.Chirp{ID: uuid.New(), QuoteOf: uuid.NullUUID{UUID: uuid.New(), Valid: true}}
+
+	chirp := FormatChirp(quote, nil)
+	if chirp.QuoteOf == nil || chirp.QuoteOf.Deleted == nil || !*chirp.QuoteOf.Deleted || chirp.QuoteOf.Chirp != nil {
+		t.Errorf("expected a tombstone, got %+v", chirp.QuoteOf)
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Follow is one side of a follow relationship, the user on the other end
+// and when the follow started
+type Follow struct {
+	UserID     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+func FormatFollower(f database.Follow) Follow {
+	return Follow{
+		UserID:     f.FollowerID,
+		FollowedAt: f.CreatedAt,
+	}
+}
+
+func FormatFollowing(f database.Follow) Follow {
+	return Follow{
+		UserID:     f.FolloweeID,
+		FollowedAt: f.CreatedAt,
+	}
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// OAuthClient is an app registered to act for users. Public clients, like
+// mobile or single page apps, have no secret and rely on PKCE alone.
+// ClientSecret is only set in the response that registers the client.
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+}
+
+func FormatOAuthClient(c database.OauthClient, secret string) OAuthClient {
+	return OAuthClient{
+		ID:           c.ID,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectUris,
+		Confidential: c.SecretHash.Valid,
+		CreatedAt:    c.CreatedAt,
+		ClientSecret: secret,
+	}
+}
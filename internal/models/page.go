@@ -0,0 +1,8 @@
+package models
+
+// Page is a single page of a cursor paginated listing
+type Page[T any] struct {
+	Data []T    `json:"data"`
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Session is a login and the refresh tokens rotated from it. Current marks
+// the session the request was made from.
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	SignedInAt time.Time `json:"signed_in_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+func FormatSession(s database.ListSessionsRow, currentID uuid.UUID) Session {
+	return Session{
+		ID:         s.FamilyID,
+		UserAgent:  s.UserAgent,
+		IP:         s.Ip,
+		SignedInAt: s.SignedInAt,
+		LastUsedAt: s.LastUsedAt,
+		ExpiresAt:  s.ExpiresAt,
+		Current:    s.FamilyID == currentID,
+	}
+}
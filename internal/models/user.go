@@ -8,23 +8,61 @@ import (
 )
 
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	IsChirpyRed  bool      `json:"is_chirpy_red"`
-	Token        string    `json:"token,omitempty"`
-	RefreshToken string    `json:"refresh_token,omitempty"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Handle        string    `json:"handle,omitempty"`
+	DisplayName   string    `json:"display_name"`
+	Bio           string    `json:"bio"`
+	AvatarURL     string    `json:"avatar_url"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	Token         string    `json:"token,omitempty"`
+	RefreshToken  string    `json:"refresh_token,omitempty"`
+	CSRFToken     string    `json:"csrf_token,omitempty"`
 }
 
 func FormatUser(u database.User, token, refreshToken string) User {
 	return User{
-		ID:           u.ID,
-		CreatedAt:    u.CreatedAt,
-		UpdatedAt:    u.UpdatedAt,
-		Email:        u.Email,
-		IsChirpyRed:  u.IsChirpyRed.Bool,
-		Token:        token,
-		RefreshToken: refreshToken,
+		ID:            u.ID,
+		CreatedAt:     u.CreatedAt,
+		UpdatedAt:     u.UpdatedAt,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerifiedAt.Valid,
+		Handle:        u.Handle.String,
+		DisplayName:   u.DisplayName,
+		Bio:           u.Bio,
+		AvatarURL:     u.AvatarUrl,
+		IsChirpyRed:   u.IsChirpyRed.Bool,
+		Token:         token,
+		RefreshToken:  refreshToken,
+	}
+}
+
+// Profile is the public view of a user, it never includes their email
+type Profile struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Handle         string    `json:"handle"`
+	DisplayName    string    `json:"display_name"`
+	Bio            string    `json:"bio"`
+	AvatarURL      string    `json:"avatar_url"`
+	ChirpCount     int       `json:"chirp_count"`
+	FollowerCount  int       `json:"follower_count"`
+	FollowingCount int       `json:"following_count"`
+}
+
+func FormatProfile(p database.GetUserProfileByHandleRow) Profile {
+	return Profile{
+		ID:             p.ID,
+		CreatedAt:      p.CreatedAt,
+		Handle:         p.Handle.String,
+		DisplayName:    p.DisplayName,
+		Bio:            p.Bio,
+		AvatarURL:      p.AvatarUrl,
+		ChirpCount:     int(p.ChirpCount),
+		FollowerCount:  int(p.FollowerCount),
+		FollowingCount: int(p.FollowingCount),
 	}
 }
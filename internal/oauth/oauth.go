@@ -0,0 +1,198 @@
+// Package oauth holds the protocol rules of chirpy's OAuth 2.0
+// authorization server: PKCE, redirect URIs, scopes and error codes.
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+)
+
+// Error codes from RFC 6749
+const (
+	ErrInvalidRequest          = "invalid_request"
+	ErrInvalidClient           = "invalid_client"
+	ErrInvalidGrant            = "invalid_grant"
+	ErrInvalidScope            = "invalid_scope"
+	ErrUnauthorizedClient      = "unauthorized_client"
+	ErrUnsupportedGrantType    = "unsupported_grant_type"
+	ErrUnsupportedResponseType = "unsupported_response_type"
+	ErrAccessDenied            = "access_denied"
+	ErrServerError             = "server_error"
+
+	// Device authorization grant errors from RFC 8628
+	ErrAuthorizationPending = "authorization_pending"
+	ErrSlowDown             = "slow_down"
+	ErrExpiredToken         = "expired_token"
+)
+
+// GrantTypeDeviceCode is the grant_type a device polls the token endpoint
+// with
+const GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Error is an OAuth error response
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// Errorf returns an OAuth error with a formatted description
+func Errorf(code, format string, args ...any) *Error {
+	return &Error{Code: code, Description: fmt.Sprintf(format, args...)}
+}
+
+const (
+	minVerifierLength = 43
+	maxVerifierLength = 128
+	challengeLength   = 43
+)
+
+// ValidChallenge reports whether s could be an S256 PKCE code challenge,
+// the base64url encoding of a SHA-256 hash
+func ValidChallenge(s string) bool {
+	if len(s) != challengeLength {
+		return false
+	}
+	_, err := base64.RawURLEncoding.DecodeString(s)
+	return err == nil
+}
+
+// VerifyPKCE reports whether verifier is the secret challenge was made
+// from with the S256 method of RFC 7636
+func VerifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < minVerifierLength || len(verifier) > maxVerifierLength {
+		return false
+	}
+	for _, c := range verifier {
+		if !isUnreserved(c) {
+			return false
+		}
+	}
+	expected := S256Challenge(verifier)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// S256Challenge returns the PKCE code challenge for verifier
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func isUnreserved(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// ValidateRedirectURI checks a redirect URI a client registers. It must be
+// absolute without a fragment, and use https unless it points at the
+// client's own machine.
+func ValidateRedirectURI(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute url", s)
+	}
+	if u.Fragment != "" || strings.Contains(s, "#") {
+		return fmt.Errorf("%q must not have a fragment", s)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if isLoopback(u.Hostname()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q must use https, or http on localhost", s)
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ParseScope parses a space separated scope parameter
+func ParseScope(s string) ([]string, error) {
+	return auth.ParseScopes(strings.Fields(s))
+}
+
+// RedirectURL adds params to a client's redirect URI, keeping any query it
+// was registered with
+func RedirectURL(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			if value != "" {
+				query.Add(key, value)
+			}
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// userCodeAlphabet has no vowels, so codes don't spell words, and no
+// letters that are easily mistaken for each other
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+const userCodeLength = 8
+
+// MakeUserCode returns a code for the user to type in when authorizing a
+// device, such as WDJB-MJHT
+func MakeUserCode() string {
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		code[i] = userCodeAlphabet[randIntn(len(userCodeAlphabet))]
+	}
+	return FormatUserCode(string(code))
+}
+
+func randIntn(n int) int {
+	// Reject bytes past the last multiple of n so every letter is equally
+	// likely
+	limit := 256 - 256%n
+	b := make([]byte, 1)
+	for {
+		rand.Read(b)
+		if int(b[0]) < limit {
+			return int(b[0]) % n
+		}
+	}
+}
+
+// NormalizeUserCode returns a user code as typed in, ignoring case, spaces
+// and dashes, in the form it is stored
+func NormalizeUserCode(s string) string {
+	var b strings.Builder
+	for _, c := range strings.ToUpper(s) {
+		if c != '-' && c != ' ' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// FormatUserCode returns a normalized user code split in half for display
+func FormatUserCode(code string) string {
+	if len(code) != userCodeLength {
+		return code
+	}
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
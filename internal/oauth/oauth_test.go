@@ -0,0 +1,116 @@
+package oauth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// Example from RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if got := S256Challenge(verifier); got != challenge {
+		t.Errorf("expected challenge %q, got %q", challenge, got)
+	}
+	if !ValidChallenge(challenge) {
+		t.Errorf("expected %q to be a valid challenge", challenge)
+	}
+	if !VerifyPKCE(verifier, challenge) {
+		t.Error("expected verifier to match challenge")
+	}
+	if VerifyPKCE(verifier+"x", challenge) {
+		t.Error("expected wrong verifier to be rejected")
+	}
+	if VerifyPKCE("short", challenge) {
+		t.Error("expected short verifier to be rejected")
+	}
+	if VerifyPKCE(strings.Repeat("a", 42)+"!", challenge) {
+		t.Error("expected verifier with reserved characters to be rejected")
+	}
+	if ValidChallenge("plain-challenge") {
+		t.Error("expected short challenge to be rejected")
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	valid := []string{
+		"https://app.example.com/callback",
+		"https://app.example.com/callback?source=chirpy",
+		"http://localhost:8000/callback",
+		"http://127.0.0.1/callback",
+		"http://[::1]:3000/cb",
+	}
+	for _, uri := range valid {
+		if err := ValidateRedirectURI(uri); err != nil {
+			t.Errorf("expected %q to be valid, got %v", uri, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"/callback",
+		"http://app.example.com/callback",
+		"https://app.example.com/callback#frag",
+		"javascript:alert(1)",
+		"ftp://app.example.com/",
+	}
+	for _, uri := range invalid {
+		if err := ValidateRedirectURI(uri); err == nil {
+			t.Errorf("expected %q to be rejected", uri)
+		}
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	scopes, err := ParseScope("chirps:write  chirps:read")
+	if err != nil {
+		t.Fatalf("ParseScope failed: %v", err)
+	}
+	if len(scopes) != 2 || scopes[0] != "chirps:read" || scopes[1] != "chirps:write" {
+		t.Errorf("unexpected scopes %v", scopes)
+	}
+	if _, err := ParseScope(""); err == nil {
+		t.Error("expected empty scope to be rejected")
+	}
+}
+
+func TestRedirectURL(t *testing.T) {
+	got := RedirectURL("https://app.example.com/cb?source=chirpy", url.Values{
+		"code":  {"abc"},
+		"state": {""},
+	})
+	expected := "https://app.example.com/cb?code=abc&source=chirpy"
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestUserCode(t *testing.T) {
+	seen := map[string]bool{}
+	for range 100 {
+		code := MakeUserCode()
+		if len(code) != 9 || code[4] != '-' {
+			t.Fatalf("unexpected code format %q", code)
+		}
+		normalized := NormalizeUserCode(code)
+		for _, c := range normalized {
+			if !strings.ContainsRune(userCodeAlphabet, c) {
+				t.Fatalf("code %q has unexpected character %q", code, c)
+			}
+		}
+		seen[normalized] = true
+
+		typed := " " + strings.ToLower(code[:2]) + " " + code[2:] + " "
+		if got := NormalizeUserCode(typed); got != normalized {
+			t.Errorf("expected %q to normalize to %q, got %q", typed, normalized, got)
+		}
+		if got := FormatUserCode(normalized); got != code {
+			t.Errorf("expected %q to format as %q, got %q", normalized, code, got)
+		}
+	}
+	if len(seen) < 99 {
+		t.Errorf("expected codes to be random, got %d distinct of 100", len(seen))
+	}
+}
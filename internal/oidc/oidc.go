@@ -0,0 +1,299 @@
+// Package oidc signs users in with an external OpenID Connect provider
+// using the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/oauth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	httpTimeout = 10 * time.Second
+	// minKeyRefresh limits how often an unknown kid refetches the
+	// provider's keys, so forged tokens can't be used to hammer it
+	minKeyRefresh = time.Minute
+	maxBodySize   = 1 << 20
+)
+
+// Config identifies chirpy to a provider. RedirectURL must be registered
+// with the provider.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// Identity is who the provider says signed in
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// Reasons an identity can't be linked to an account by email
+var (
+	ErrEmailNotVerified   = errors.New("provider hasn't verified the email")
+	ErrAccountNotVerified = errors.New("account hasn't verified the email")
+)
+
+// CanLink returns why the identity can't be linked to the account using
+// the same email, or nil if it can. Both sides must have verified the
+// email, otherwise whoever signed up with an address they don't own would
+// be handed its owner's sign ins, or the other way around.
+func (id Identity) CanLink(accountEmailVerified bool) error {
+	if !id.EmailVerified || id.Email == "" {
+		return ErrEmailNotVerified
+	}
+	if !accountEmailVerified {
+		return ErrAccountNotVerified
+	}
+	return nil
+}
+
+// Provider is an OpenID Connect provider. Its endpoints and keys are
+// discovered from the issuer the first time they are needed.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu            sync.Mutex
+	metadata      *metadata
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+// metadata is the part of the provider's discovery document chirpy uses
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewProvider returns a provider for config. client defaults to one with
+// a short timeout when nil.
+func NewProvider(config Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeout}
+	}
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	return &Provider{config: config, client: client}
+}
+
+// Issuer returns the provider's issuer identifier
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+// AuthCodeURL returns the provider's page to send the user to. state and
+// nonce tie the response to this request, and verifier is the PKCE secret
+// to redeem the code with.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return oauth.RedirectURL(md.AuthorizationEndpoint, url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {"openid email"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {oauth.S256Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}), nil
+}
+
+// Exchange redeems an authorization code and returns the identity in the
+// verified ID token
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Identity, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Identity{}, fmt.Errorf("unable to redeem code: %v", err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxBodySize)).Decode(&body)
+	if resp.StatusCode != http.StatusOK {
+		return Identity{}, fmt.Errorf("provider rejected code with status %d: %s %s", resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid token response: %v", err)
+	}
+	if body.IDToken == "" {
+		return Identity{}, fmt.Errorf("token response has no id_token")
+	}
+
+	return p.Verify(ctx, body.IDToken, nonce)
+}
+
+// idTokenClaims are the ID token claims chirpy reads. Some providers send
+// email_verified as a string.
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	AZP           string `json:"azp"`
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"`
+}
+
+// Verify checks an ID token was signed by the provider for chirpy in
+// response to the request with nonce
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (Identity, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	claims := idTokenClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(md.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid id token: %v", err)
+	}
+	if claims.Nonce != nonce {
+		return Identity{}, fmt.Errorf("invalid id token: nonce doesn't match")
+	}
+	if claims.AZP != "" && claims.AZP != p.config.ClientID {
+		return Identity{}, fmt.Errorf("invalid id token: issued to another client")
+	}
+	if claims.Subject == "" {
+		return Identity{}, fmt.Errorf("invalid id token: no subject")
+	}
+
+	verified := false
+	switch v := claims.EmailVerified.(type) {
+	case bool:
+		verified = v
+	case string:
+		verified = v == "true"
+	}
+	return Identity{
+		Issuer:        md.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: verified,
+	}, nil
+}
+
+// discover fetches the provider's discovery document, once
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	md := &metadata{}
+	err := p.getJSON(ctx, p.config.Issuer+"/.well-known/openid-configuration", md)
+	if err != nil {
+		return nil, fmt.Errorf("unable to discover provider: %v", err)
+	}
+	if strings.TrimSuffix(md.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("provider claims to be issuer %q, expected %q", md.Issuer, p.config.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("provider discovery document is missing endpoints")
+	}
+	p.metadata = md
+	return md, nil
+}
+
+// key returns the provider's public key kid, refetching the provider's
+// keys when kid is unknown in case they were rotated
+func (p *Provider) key(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < minKeyRefresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	jwks := auth.JWKS{}
+	err := p.getJSON(ctx, p.metadata.JWKSURI, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get provider keys: %v", err)
+	}
+	p.keysFetchedAt = time.Now()
+	p.keys = map[string]any{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		p.keys[jwk.Kid] = key
+	}
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxBodySize)).Decode(v)
+}
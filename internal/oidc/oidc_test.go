@@ -0,0 +1,304 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/evanwiseman/chirpy/internal/auth"
+	"github.com/evanwiseman/chirpy/internal/oauth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "chirpy"
+	testClientSecret = "s3cret"
+	testRedirectURL  = "http://localhost:8080/api/login/oidc/callback"
+)
+
+// mockProvider is an in-process OpenID Connect provider. Codes are issued
+// directly with authorize instead of through a login page.
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu     sync.Mutex
+	kid    string
+	key    *rsa.PrivateKey
+	issuer string
+	codes  map[string]mockGrant
+}
+
+type mockGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	m := &mockProvider{t: t, codes: map[string]mockGrant{}}
+	m.rotateKey("key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.issuer,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		json.NewEncoder(w).Encode(auth.JWKS{Keys: []auth.JWK{{
+			Kty: "RSA",
+			Kid: m.kid,
+			Alg: "RS256",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", m.handleToken)
+	m.server = httptest.NewServer(mux)
+	m.issuer = m.server.URL
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockProvider) rotateKey(kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		m.t.Fatalf("GenerateKey failed: %v", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.kid, m.key = kid, key
+}
+
+// authorize issues a code as though the user signed in, for an ID token
+// with claims on top of the defaults
+func (m *mockProvider) authorize(authURL string, claims jwt.MapClaims) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatalf("invalid auth url: %v", err)
+	}
+	query := u.Query()
+	token := jwt.MapClaims{
+		"iss":            m.issuer,
+		"aud":            query.Get("client_id"),
+		"sub":            "user-123",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"nonce":          query.Get("nonce"),
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Minute).Unix(),
+	}
+	for k, v := range claims {
+		token[k] = v
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code := "code-" + query.Get("state")
+	m.codes[code] = mockGrant{challenge: query.Get("code_challenge"), claims: token}
+	return code
+}
+
+func (m *mockProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clientID, secret, _ := r.BasicAuth()
+	if clientID != testClientID || secret != testClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(oauth.Errorf(oauth.ErrInvalidClient, "bad credentials"))
+		return
+	}
+	grant, ok := m.codes[r.PostFormValue("code")]
+	delete(m.codes, r.PostFormValue("code"))
+	if !ok || r.PostFormValue("redirect_uri") != testRedirectURL ||
+		!oauth.VerifyPKCE(r.PostFormValue("code_verifier"), grant.challenge) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(oauth.Errorf(oauth.ErrInvalidGrant, "bad code"))
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+	token.Header["kid"] = m.kid
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		m.t.Fatalf("SignedString failed: %v", err)
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "opaque",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func newTestProvider(m *mockProvider) *Provider {
+	return NewProvider(Config{
+		Issuer:       m.issuer,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, m.server.Client())
+}
+
+const testVerifier = "0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestExchange(t *testing.T) {
+	m := newMockProvider(t)
+	p := newTestProvider(m)
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", testVerifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL failed: %v", err)
+	}
+	if !strings.HasPrefix(authURL, m.server.URL+"/authorize?") {
+		t.Errorf("unexpected auth url %q", authURL)
+	}
+	query, _ := url.ParseQuery(authURL[strings.Index(authURL, "?")+1:])
+	if query.Get("client_id") != testClientID || query.Get("redirect_uri") != testRedirectURL ||
+		query.Get("state") != "state-1" || query.Get("nonce") != "nonce-1" ||
+		query.Get("code_challenge") != oauth.S256Challenge(testVerifier) || query.Get("scope") != "openid email" {
+		t.Errorf("unexpected auth url parameters %v", query)
+	}
+
+	code := m.authorize(authURL, nil)
+	identity, err := p.Exchange(ctx, code, testVerifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	expected := Identity{Issuer: m.issuer, Subject: "user-123", Email: "user@example.com", EmailVerified: true}
+	if identity != expected {
+		t.Errorf("expected %+v, got %+v", expected, identity)
+	}
+
+	// Codes can't be redeemed twice
+	if _, err := p.Exchange(ctx, code, testVerifier, "nonce-1"); err == nil {
+		t.Error("expected reused code to be rejected")
+	}
+}
+
+func TestExchangeRejectsBadTokens(t *testing.T) {
+	m := newMockProvider(t)
+	p := newTestProvider(m)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		claims   jwt.MapClaims
+		verifier string
+		nonce    string
+	}{
+		{name: "wrong verifier", verifier: testVerifier + "x", nonce: "nonce"},
+		{name: "wrong nonce", verifier: testVerifier, nonce: "other"},
+		{name: "other audience", claims: jwt.MapClaims{"aud": "someone-else"}, verifier: testVerifier, nonce: "nonce"},
+		{name: "other issuer", claims: jwt.MapClaims{"iss": "https://evil.example.com"}, verifier: testVerifier, nonce: "nonce"},
+		{name: "expired", claims: jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, verifier: testVerifier, nonce: "nonce"},
+		{name: "other authorized party", claims: jwt.MapClaims{"azp": "someone-else"}, verifier: testVerifier, nonce: "nonce"},
+		{name: "no subject", claims: jwt.MapClaims{"sub": ""}, verifier: testVerifier, nonce: "nonce"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := "state-" + string(rune('a'+i))
+			authURL, err := p.AuthCodeURL(ctx, state, "nonce", testVerifier)
+			if err != nil {
+				t.Fatalf("AuthCodeURL failed: %v", err)
+			}
+			code := m.authorize(authURL, tt.claims)
+			if _, err := p.Exchange(ctx, code, tt.verifier, tt.nonce); err == nil {
+				t.Error("expected exchange to fail")
+			}
+		})
+	}
+}
+
+func TestEmailVerifiedString(t *testing.T) {
+	m := newMockProvider(t)
+	p := newTestProvider(m)
+	ctx := context.Background()
+
+	for _, verified := range []any{"true", "false", false} {
+		authURL, _ := p.AuthCodeURL(ctx, "state", "nonce", testVerifier)
+		code := m.authorize(authURL, jwt.MapClaims{"email_verified": verified})
+		identity, err := p.Exchange(ctx, code, testVerifier, "nonce")
+		if err != nil {
+			t.Fatalf("Exchange failed: %v", err)
+		}
+		if identity.EmailVerified != (verified == "true") {
+			t.Errorf("email_verified %v read as %v", verified, identity.EmailVerified)
+		}
+	}
+}
+
+func TestIdentityCanLink(t *testing.T) {
+	cases := []struct {
+		name            string
+		identity        Identity
+		accountVerified bool
+		expected        error
+	}{
+		{name: "both verified", identity: Identity{Email: "a@example.com", EmailVerified: true}, accountVerified: true},
+		{name: "unverified account", identity: Identity{Email: "a@example.com", EmailVerified: true}, expected: ErrAccountNotVerified},
+		{name: "unverified identity", identity: Identity{Email: "a@example.com"}, accountVerified: true, expected: ErrEmailNotVerified},
+		{name: "no email", identity: Identity{EmailVerified: true}, accountVerified: true, expected: ErrEmailNotVerified},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.identity.CanLink(tc.accountVerified); !errors.Is(err, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	m := newMockProvider(t)
+	p := newTestProvider(m)
+	ctx := context.Background()
+
+	authURL, _ := p.AuthCodeURL(ctx, "state-1", "nonce", testVerifier)
+	if _, err := p.Exchange(ctx, m.authorize(authURL, nil), testVerifier, "nonce"); err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+
+	// A new key isn't fetched again right away
+	m.rotateKey("key-2")
+	authURL, _ = p.AuthCodeURL(ctx, "state-2", "nonce", testVerifier)
+	if _, err := p.Exchange(ctx, m.authorize(authURL, nil), testVerifier, "nonce"); err == nil {
+		t.Error("expected unknown key to be rejected until keys can be refetched")
+	}
+
+	// Once enough time has passed it is
+	p.keysFetchedAt = time.Now().Add(-minKeyRefresh)
+	authURL, _ = p.AuthCodeURL(ctx, "state-3", "nonce", testVerifier)
+	if _, err := p.Exchange(ctx, m.authorize(authURL, nil), testVerifier, "nonce"); err != nil {
+		t.Errorf("expected rotated key to be fetched, got %v", err)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	m := newMockProvider(t)
+	m.issuer = "https://evil.example.com"
+	p := NewProvider(Config{Issuer: m.server.URL, ClientID: testClientID}, m.server.Client())
+
+	if _, err := p.AuthCodeURL(context.Background(), "state", "nonce", testVerifier); err == nil {
+		t.Error("expected discovery to reject a mismatched issuer")
+	}
+}
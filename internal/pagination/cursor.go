@@ -0,0 +1,206 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Direction describes which way a cursor pages relative to the sort order
+type Direction string
+
+const (
+	Next Direction = "next"
+	Prev Direction = "prev"
+)
+
+// Sort is the order a listing is returned in
+type Sort string
+
+const (
+	SortAsc  Sort = "asc"
+	SortDesc Sort = "desc"
+	// SortTop orders by a score such as like count, highest first
+	SortTop Sort = "top"
+)
+
+// Cursor is the position of a row in a keyset ordered by (created_at, id),
+// or by (score, created_at, id) when sorting by top. It is handed to
+// clients as an opaque string.
+type Cursor struct {
+	Score     int64     `json:"n,omitempty"`
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+	Sort      Sort      `json:"s"`
+	Direction Direction `json:"d"`
+}
+
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("malformed cursor")
+	}
+
+	var c Cursor
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("malformed cursor")
+	}
+	if c.Direction != Next && c.Direction != Prev {
+		return Cursor{}, fmt.Errorf("invalid cursor direction")
+	}
+	if _, err := ParseSort(string(c.Sort)); err != nil {
+		return Cursor{}, err
+	}
+	return c, nil
+}
+
+// Params are the paging options requested by a client
+type Params struct {
+	Limit  int
+	Sort   Sort
+	Cursor *Cursor
+}
+
+// ParseQuery reads the limit, sort and cursor query parameters, using
+// defaultSort when no sort is given. A cursor carries its own sort order
+// which wins over the sort parameter.
+func ParseQuery(query url.Values, defaultSort Sort) (Params, error) {
+	limit, err := ParseLimit(query.Get("limit"))
+	if err != nil {
+		return Params{}, fmt.Errorf("invalid limit: %v", err)
+	}
+
+	sort := defaultSort
+	if query.Has("sort") {
+		sort, err = ParseSort(query.Get("sort"))
+		if err != nil {
+			return Params{}, err
+		}
+	}
+
+	p := Params{Limit: limit, Sort: sort}
+	if query.Has("cursor") {
+		c, err := DecodeCursor(query.Get("cursor"))
+		if err != nil {
+			return Params{}, fmt.Errorf("invalid cursor: %v", err)
+		}
+		p.Cursor = &c
+		p.Sort = c.Sort
+	}
+	return p, nil
+}
+
+// ParseSort returns the requested sort order, defaulting to ascending
+func ParseSort(s string) (Sort, error) {
+	switch Sort(s) {
+	case "", SortAsc:
+		return SortAsc, nil
+	case SortDesc:
+		return SortDesc, nil
+	case SortTop:
+		return SortTop, nil
+	}
+	return "", fmt.Errorf("invalid sort %q", s)
+}
+
+// ParseLimit returns the requested page size, capped at MaxLimit
+func ParseLimit(s string) (int, error) {
+	if s == "" {
+		return DefaultLimit, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("limit must be a positive integer")
+	}
+	return min(limit, MaxLimit), nil
+}
+
+// LinkHeader builds an RFC 8288 Link header pointing at the next and
+// previous pages of u. Empty cursors are left out.
+func LinkHeader(u *url.URL, next, prev string) string {
+	var links []string
+	for _, link := range []struct {
+		rel    string
+		cursor string
+	}{
+		{"next", next},
+		{"prev", prev},
+	} {
+		if link.cursor == "" {
+			continue
+		}
+		q := u.Query()
+		q.Del("sort")
+		q.Set("cursor", link.cursor)
+		pageURL := url.URL{Path: u.Path, RawQuery: q.Encode()}
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, pageURL.String(), link.rel))
+	}
+	return strings.Join(links, ", ")
+}
+
+// Ascending reports whether the rows for a page should be fetched in
+// ascending key order. Paging backwards walks the keyset in reverse.
+func Ascending(sort Sort, from *Cursor) bool {
+	backward := from != nil && from.Direction == Prev
+	return (sort == SortAsc) != backward
+}
+
+// Paginate turns rows fetched with one row beyond limit into a page in
+// display order along with the cursors for the neighbouring pages. key
+// returns the keyset position of a row, its sort and direction are filled
+// in by Paginate.
+func Paginate[T any](rows []T, limit int, sort Sort, from *Cursor, key func(T) Cursor) ([]T, string, string) {
+	hasMore := len(rows) > limit
+	if hasMore {
+		rows = rows[:limit]
+	}
+	if len(rows) == 0 {
+		return []T{}, "", ""
+	}
+
+	backward := from != nil && from.Direction == Prev
+	if backward {
+		slices.Reverse(rows)
+	}
+
+	cursor := func(row T, d Direction) string {
+		c := key(row)
+		c.Sort = sort
+		c.Direction = d
+		return c.Encode()
+	}
+
+	var next, prev string
+	if backward {
+		next = cursor(rows[len(rows)-1], Next)
+		if hasMore {
+			prev = cursor(rows[0], Prev)
+		}
+	} else {
+		if hasMore {
+			next = cursor(rows[len(rows)-1], Next)
+		}
+		if from != nil {
+			prev = cursor(rows[0], Prev)
+		}
+	}
+	return rows, next, prev
+}
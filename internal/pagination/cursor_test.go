@@ -0,0 +1,191 @@
+package pagination
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := Cursor{
+		CreatedAt: time.Date(2025, 10, 2, 12, 34, 56, 123456000, time.UTC),
+		ID:        uuid.New(),
+		Score:     42,
+		Sort:      SortTop,
+		Direction: Prev,
+	}
+
+	got, err := DecodeCursor(want.Encode())
+	if err != nil {
+		t.Fatalf("DecodeCursor failed: %v", err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID || got.Score != want.Score || got.Sort != want.Sort || got.Direction != want.Direction {
+		t.Errorf("expected cursor %+v, got %+v", want, got)
+	}
+}
+
+func TestDecodeInvalidCursor(t *testing.T) {
+	cases := []string{
+		"not a cursor!",
+		Cursor{Sort: SortAsc, Direction: "sideways"}.Encode(),
+		Cursor{Sort: "random", Direction: Next}.Encode(),
+	}
+	for _, s := range cases {
+		if _, err := DecodeCursor(s); err == nil {
+			t.Errorf("expected cursor %q to be rejected", s)
+		}
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected int
+		wantErr  bool
+	}{
+		{"", DefaultLimit, false},
+		{"5", 5, false},
+		{"100000", MaxLimit, false},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"ten", 0, true},
+	}
+	for _, tc := range cases {
+		limit, err := ParseLimit(tc.input)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseLimit(%q): expected error: %v, got: %v", tc.input, tc.wantErr, err)
+		}
+		if limit != tc.expected {
+			t.Errorf("ParseLimit(%q): expected %d, got %d", tc.input, tc.expected, limit)
+		}
+	}
+}
+
+type row struct {
+	createdAt time.Time
+	id        uuid.UUID
+}
+
+func rowKey(r row) Cursor {
+	return Cursor{CreatedAt: r.createdAt, ID: r.id}
+}
+
+func makeRows(n int) []row {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := make([]row, n)
+	for i := range rows {
+		rows[i] = row{createdAt: start.Add(time.Duration(i) * time.Minute), id: uuid.New()}
+	}
+	return rows
+}
+
+func TestPaginateFirstPage(t *testing.T) {
+	rows := makeRows(4)
+
+	page, next, prev := Paginate(rows, 3, SortAsc, nil, rowKey)
+	if len(page) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(page))
+	}
+	if prev != "" {
+		t.Errorf("expected no prev cursor on the first page, got %q", prev)
+	}
+
+	c, err := DecodeCursor(next)
+	if err != nil {
+		t.Fatalf("DecodeCursor failed: %v", err)
+	}
+	if c.ID != rows[2].id || c.Direction != Next {
+		t.Errorf("expected next cursor after row 2, got %+v", c)
+	}
+}
+
+func TestPaginateLastPage(t *testing.T) {
+	rows := makeRows(2)
+	from := &Cursor{Sort: SortAsc, Direction: Next}
+
+	page, next, prev := Paginate(rows, 3, SortAsc, from, rowKey)
+	if len(page) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(page))
+	}
+	if next != "" {
+		t.Errorf("expected no next cursor on the last page, got %q", next)
+	}
+
+	c, err := DecodeCursor(prev)
+	if err != nil {
+		t.Fatalf("DecodeCursor failed: %v", err)
+	}
+	if c.ID != rows[0].id || c.Direction != Prev {
+		t.Errorf("expected prev cursor before row 0, got %+v", c)
+	}
+}
+
+func TestPaginateBackward(t *testing.T) {
+	// Rows arrive in reverse key order when paging backwards
+	rows := makeRows(4)
+	fetched := []row{rows[3], rows[2], rows[1], rows[0]}
+	from := &Cursor{Sort: SortAsc, Direction: Prev}
+
+	page, next, prev := Paginate(fetched, 3, SortAsc, from, rowKey)
+	if len(page) != 3 || page[0].id != rows[1].id || page[2].id != rows[3].id {
+		t.Fatalf("expected rows 1-3 in ascending order, got %v", page)
+	}
+	if next == "" || prev == "" {
+		t.Errorf("expected both cursors, got next=%q prev=%q", next, prev)
+	}
+}
+
+func TestAscending(t *testing.T) {
+	if !Ascending(SortAsc, nil) || Ascending(SortDesc, nil) {
+		t.Error("expected first page to follow the sort order")
+	}
+	if Ascending(SortAsc, &Cursor{Direction: Prev}) || !Ascending(SortDesc, &Cursor{Direction: Prev}) {
+		t.Error("expected prev cursor to reverse the sort order")
+	}
+	if Ascending(SortTop, nil) || !Ascending(SortTop, &Cursor{Direction: Prev}) {
+		t.Error("expected top to page highest first")
+	}
+}
+
+func TestLinkHeader(t *testing.T) {
+	u, _ := url.Parse("/api/chirps?author_id=abc&sort=desc&limit=5")
+
+	link := LinkHeader(u, "n1", "")
+	if !strings.Contains(link, `rel="next"`) || strings.Contains(link, `rel="prev"`) {
+		t.Errorf("unexpected link header: %s", link)
+	}
+	if !strings.Contains(link, "cursor=n1") || !strings.Contains(link, "author_id=abc") || strings.Contains(link, "sort=") {
+		t.Errorf("expected link to keep filters and replace sort with cursor: %s", link)
+	}
+
+	if LinkHeader(u, "", "") != "" {
+		t.Error("expected empty link header without cursors")
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	p, err := ParseQuery(url.Values{}, SortDesc)
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+	if p.Sort != SortDesc || p.Limit != DefaultLimit || p.Cursor != nil {
+		t.Errorf("expected defaults, got %+v", p)
+	}
+
+	// A cursor's sort order wins over the sort parameter
+	cursor := Cursor{ID: uuid.New(), Sort: SortAsc, Direction: Next}
+	p, err = ParseQuery(url.Values{"sort": {"desc"}, "cursor": {cursor.Encode()}}, SortDesc)
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+	if p.Sort != SortAsc || p.Cursor == nil || p.Cursor.ID != cursor.ID {
+		t.Errorf("expected cursor sort to win, got %+v", p)
+	}
+
+	if _, err := ParseQuery(url.Values{"sort": {"sideways"}}, SortAsc); err == nil {
+		t.Error("expected invalid sort to be rejected")
+	}
+}
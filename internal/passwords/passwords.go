@@ -0,0 +1,154 @@
+// Package passwords checks new passwords against a strength policy and a
+// local corpus of passwords known to have been breached.
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Defaults for a Policy
+const (
+	DefaultMinLength  = 8
+	DefaultMaxLength  = 128
+	DefaultMinEntropy = 35
+)
+
+// ErrWeakPassword is wrapped by every reason Check rejects a password for
+var ErrWeakPassword = errors.New("password is too weak")
+
+// Policy is what new passwords must meet
+type Policy struct {
+	MinLength  int
+	MaxLength  int
+	MinEntropy float64
+	// Breached is checked when set
+	Breached *Corpus
+}
+
+// Check returns an error wrapping ErrWeakPassword, saying what to change,
+// when password doesn't meet the policy. Any other error means the check
+// couldn't be made.
+func (p Policy) Check(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("%w, use at least %d characters", ErrWeakPassword, p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf("%w, use at most %d characters", ErrWeakPassword, p.MaxLength)
+	}
+	if Entropy(password) < p.MinEntropy {
+		return fmt.Errorf("%w, make it longer or mix in other kinds of characters", ErrWeakPassword)
+	}
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return fmt.Errorf("unable to check breached passwords: %w", err)
+		}
+		if breached {
+			return fmt.Errorf("%w, it has appeared in a data breach", ErrWeakPassword)
+		}
+	}
+	return nil
+}
+
+// Entropy estimates the bits of entropy in password from the kinds of
+// characters it uses. Characters that repeat or continue a run from the
+// one before, like "aaa" or "1234", only add a bit.
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, c := range password {
+		switch {
+		case 'a' <= c && c <= 'z':
+			lower = true
+		case 'A' <= c && c <= 'Z':
+			upper = true
+		case '0' <= c && c <= '9':
+			digit = true
+		case ' ' <= c && c <= '~':
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	bitsPerChar := math.Log2(float64(pool))
+	bits := 0.0
+	prev := rune(-1)
+	for _, c := range password {
+		if c == prev || c == prev+1 || c == prev-1 {
+			bits++
+		} else {
+			bits += bitsPerChar
+		}
+		prev = c
+	}
+	return bits
+}
+
+// Corpus is a local copy of breached password hashes, laid out like the
+// Pwned Passwords range API. Each file is named for the first 5 hex
+// characters of a SHA-1 hash, as PREFIX.txt, and holds a line per hash of
+// its remaining 35 characters and how often it was seen, like
+// 0018A45C4D1DEF81644B54AB7F969B88D65:3.
+type Corpus struct {
+	dir string
+}
+
+// OpenCorpus returns the corpus in dir
+func OpenCorpus(dir string) (*Corpus, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s isn't a directory", dir)
+	}
+	return &Corpus{dir: dir}, nil
+}
+
+// Contains reports whether password's hash is in the corpus. Padding
+// lines, seen 0 times, don't count.
+func (c *Corpus) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	f, err := os.Open(filepath.Join(c.dir, hash[:5]+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		suffix, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(suffix, hash[5:]) {
+			return count != "0", nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,122 @@
+package passwords
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeCorpus writes a corpus holding each password with count
+func writeCorpus(t *testing.T, counts map[string]string) string {
+	dir := t.TempDir()
+	for password, count := range counts {
+		sum := sha1.Sum([]byte(password))
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+		f, err := os.OpenFile(filepath.Join(dir, hash[:5]+".txt"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			t.Fatalf("unable to write corpus: %v", err)
+		}
+		f.WriteString("0005AD76BD555C1D6D771DE417A4B87E4B4:10\r\n" + hash[5:] + ":" + count + "\r\n")
+		f.Close()
+	}
+	return dir
+}
+
+func TestEntropy(t *testing.T) {
+	cases := []struct {
+		password string
+		min, max float64
+	}{
+		{password: "", min: 0, max: 0},
+		{password: "aaaaaaaaaaaa", min: 15, max: 16},
+		{password: "abcdefghijkl", min: 15, max: 16},
+		{password: "password", min: 33, max: 34},
+		{password: "Tr0ub4dor&3", min: 70, max: 75},
+		{password: "correct horse battery staple", min: 140, max: 170},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.password, func(t *testing.T) {
+			bits := Entropy(tc.password)
+			if bits < tc.min || bits > tc.max {
+				t.Errorf("expected %v-%v bits, got %v", tc.min, tc.max, bits)
+			}
+		})
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	corpus, err := OpenCorpus(writeCorpus(t, map[string]string{"Password1": "52579"}))
+	if err != nil {
+		t.Fatalf("OpenCorpus failed: %v", err)
+	}
+	policy := Policy{
+		MinLength:  DefaultMinLength,
+		MaxLength:  DefaultMaxLength,
+		MinEntropy: DefaultMinEntropy,
+		Breached:   corpus,
+	}
+
+	cases := []struct {
+		name     string
+		password string
+		weak     bool
+	}{
+		{name: "strong", password: "correct horse battery staple"},
+		{name: "empty", password: "", weak: true},
+		{name: "too short", password: "x9!Qz", weak: true},
+		{name: "too long", password: strings.Repeat("ab", DefaultMaxLength), weak: true},
+		{name: "predictable", password: "aaaaaaaaaaaaaaaa", weak: true},
+		{name: "breached", password: "Password1", weak: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.Check(tc.password)
+			if tc.weak != errors.Is(err, ErrWeakPassword) {
+				t.Errorf("expected weak: %v, got: %v", tc.weak, err)
+			}
+			if !tc.weak && err != nil {
+				t.Errorf("expected no error, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestCorpusContains(t *testing.T) {
+	corpus, err := OpenCorpus(writeCorpus(t, map[string]string{"hunter2": "17043", "padding": "0"}))
+	if err != nil {
+		t.Fatalf("OpenCorpus failed: %v", err)
+	}
+
+	for password, expected := range map[string]bool{
+		"hunter2": true,
+		"padding": false,
+		"Hunter2": false,
+		"another": false,
+	} {
+		breached, err := corpus.Contains(password)
+		if err != nil {
+			t.Fatalf("Contains failed: %v", err)
+		}
+		if breached != expected {
+			t.Errorf("expected %q breached: %v, got %v", password, expected, breached)
+		}
+	}
+}
+
+func TestOpenCorpusErrors(t *testing.T) {
+	if _, err := OpenCorpus(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected missing directory to fail")
+	}
+
+	file := filepath.Join(t.TempDir(), "corpus.txt")
+	os.WriteFile(file, nil, 0o600)
+	if _, err := OpenCorpus(file); err == nil {
+		t.Error("expected a file to fail")
+	}
+}
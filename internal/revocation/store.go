@@ -0,0 +1,101 @@
+package revocation
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/evanwiseman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Store is the access token denylist. Revoked tokens are kept in Postgres
+// so every server sees them, and mirrored in memory so validating a token
+// doesn't cost a query. Tokens revoked by another server are picked up the
+// next time the store syncs.
+type Store struct {
+	db *database.Queries
+
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+func NewStore(db *database.Queries) *Store {
+	return &Store{
+		db:      db,
+		revoked: map[string]time.Time{},
+	}
+}
+
+// IsRevoked reports whether the token with the given jti was revoked.
+// Tokens drop out of the denylist once they expire, since they are
+// rejected anyway.
+func (s *Store) IsRevoked(jti string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	expiresAt, ok := s.revoked[jti]
+	return ok && time.Now().Before(expiresAt)
+}
+
+// Revoke denylists the token with the given jti until it expires
+func (s *Store) Revoke(ctx context.Context, jti string, userID uuid.UUID, expiresAt time.Time) error {
+	err := s.db.RevokeAccessToken(ctx, database.RevokeAccessTokenParams{
+		Jti:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[jti] = expiresAt
+	return nil
+}
+
+// Sync prunes expired tokens from Postgres and reloads the denylist
+func (s *Store) Sync(ctx context.Context) error {
+	_, err := s.db.DeleteExpiredRevokedAccessTokens(ctx)
+	if err != nil {
+		return err
+	}
+	rows, err := s.db.ListRevokedAccessTokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	revoked := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		revoked[row.Jti] = row.ExpiresAt
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Keep tokens revoked here while the query ran
+	now := time.Now()
+	for jti, expiresAt := range s.revoked {
+		if now.Before(expiresAt) {
+			revoked[jti] = expiresAt
+		}
+	}
+	s.revoked = revoked
+	return nil
+}
+
+// Run syncs the store every interval until ctx is done
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Sync(ctx); err != nil {
+				log.Printf("unable to sync revoked access tokens: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package search
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/evanwiseman/chirpy/internal/entities"
+)
+
+// StartSel and StopSel surround matched words in snippets produced by
+// Postgres, they match chr(57344) and chr(57345) in the search queries.
+// They are private use code points so they can't be confused with markup
+// typed into a chirp.
+const (
+	StartSel = "\ue000"
+	StopSel  = "\ue001"
+)
+
+const dateLayout = "2006-01-02"
+
+// Query is a parsed search. TSQuery is an expression for to_tsquery, the
+// other fields are filters and are zero when not given.
+type Query struct {
+	TSQuery string
+	From    string
+	Since   time.Time
+	Until   time.Time
+}
+
+// Parse turns a search string into a Query. Words must all match, "quoted
+// phrases" must match in order and a trailing '*' matches a prefix.
+// from:handle limits results to one author, since:YYYY-MM-DD and
+// until:YYYY-MM-DD limit them to a date range, both days inclusive.
+func Parse(s string) (Query, error) {
+	var q Query
+	var terms []string
+	for _, tok := range tokenize(s) {
+		if tok.phrase {
+			if words := lexemes(tok.text); len(words) > 0 {
+				terms = append(terms, "("+strings.Join(words, " <-> ")+")")
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(tok.text, ":")
+		if ok && value != "" {
+			switch strings.ToLower(key) {
+			case "from":
+				handle := entities.NormalizeHandle(value)
+				if !entities.ValidHandle(handle) {
+					return Query{}, fmt.Errorf("invalid handle %q", value)
+				}
+				q.From = handle
+				continue
+			case "since":
+				t, err := time.Parse(dateLayout, value)
+				if err != nil {
+					return Query{}, fmt.Errorf("invalid since date %q, expected YYYY-MM-DD", value)
+				}
+				q.Since = t
+				continue
+			case "until":
+				t, err := time.Parse(dateLayout, value)
+				if err != nil {
+					return Query{}, fmt.Errorf("invalid until date %q, expected YYYY-MM-DD", value)
+				}
+				// Until is inclusive, so match anything before the next day
+				q.Until = t.AddDate(0, 0, 1)
+				continue
+			}
+		}
+
+		words := lexemes(tok.text)
+		if len(words) == 0 {
+			continue
+		}
+		if strings.HasSuffix(tok.text, "*") {
+			words[len(words)-1] += ":*"
+		}
+		terms = append(terms, words...)
+	}
+
+	if len(terms) == 0 {
+		return Query{}, fmt.Errorf("search has no words to match")
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Since.Before(q.Until) {
+		return Query{}, fmt.Errorf("since must not be after until")
+	}
+	q.TSQuery = strings.Join(terms, " & ")
+	return q, nil
+}
+
+// Highlight escapes a snippet for HTML and wraps matched words in <mark>
+func Highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, StartSel, "<mark>")
+	return strings.ReplaceAll(snippet, StopSel, "</mark>")
+}
+
+type token struct {
+	text   string
+	phrase bool
+}
+
+// tokenize splits s on whitespace, keeping "quoted phrases" together. An
+// unclosed quote runs to the end of s.
+func tokenize(s string) []token {
+	var tokens []token
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if rest, ok := strings.CutPrefix(s, `"`); ok {
+			phrase, after, _ := strings.Cut(rest, `"`)
+			tokens = append(tokens, token{text: phrase, phrase: true})
+			s = after
+			continue
+		}
+		end := strings.IndexFunc(s, unicode.IsSpace)
+		if end < 0 {
+			end = len(s)
+		}
+		tokens = append(tokens, token{text: s[:end]})
+		s = s[end:]
+	}
+	return tokens
+}
+
+// lexemes returns the runs of letters and digits in s lowercased. Anything
+// else is dropped so the result is always safe to use in a tsquery.
+func lexemes(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
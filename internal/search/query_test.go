@@ -0,0 +1,82 @@
+package search
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		expected Query
+	}{
+		{
+			name:     "words",
+			input:    "Hello  World",
+			expected: Query{TSQuery: "hello & world"},
+		},
+		{
+			name:     "phrase and prefix",
+			input:    `"kernel panic" debug*`,
+			expected: Query{TSQuery: "(kernel <-> panic) & debug:*"},
+		},
+		{
+			name:     "drops tsquery syntax",
+			input:    "a&b | !c (d):*",
+			expected: Query{TSQuery: "a & b & c & d:*"},
+		},
+		{
+			name:  "filters",
+			input: "golang from:@Gopher since:2025-01-01 until:2025-01-31",
+			expected: Query{
+				TSQuery: "golang",
+				From:    "gopher",
+				Since:   time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+				Until:   time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:     "unclosed quote",
+			input:    `"hello there`,
+			expected: Query{TSQuery: "(hello <-> there)"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Parse(tc.input)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if got.TSQuery != tc.expected.TSQuery || got.From != tc.expected.From ||
+				!got.Since.Equal(tc.expected.Since) || !got.Until.Equal(tc.expected.Until) {
+				t.Errorf("expected %+v, got %+v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	cases := []string{
+		"",
+		"from:gopher",
+		`"" *`,
+		"golang from:not-a-handle",
+		"golang since:yesterday",
+		"golang since:2025-02-01 until:2025-01-01",
+	}
+	for _, input := range cases {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("expected %q to be rejected", input)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	snippet := "<b>" + StartSel + "golang" + StopSel + "</b> rocks"
+	expected := "&lt;b&gt;<mark>golang</mark>&lt;/b&gt; rocks"
+	if got := Highlight(snippet); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
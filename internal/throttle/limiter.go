@@ -0,0 +1,246 @@
+package throttle
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/evanwiseman/chirpy/internal/database"
+)
+
+const (
+	scopeAccount = "account"
+	scopeIP      = "ip"
+)
+
+// Limiter tracks failed logins per account and per client IP in Postgres,
+// so every server enforces the same limits. Accounts are tracked by email
+// whether or not one is registered, so lockouts don't reveal which are.
+type Limiter struct {
+	conn *sql.DB
+	db   *database.Queries
+	// prefix keeps each limiter's counters apart in the shared table
+	prefix string
+
+	Account Policy
+	IP      Policy
+}
+
+// NewLimiter returns a limiter that starts backing off an account after 5
+// failures and an address after 20, locking either out for up to 15
+// minutes at a time
+func NewLimiter(conn *sql.DB, db *database.Queries) *Limiter {
+	return &Limiter{
+		conn: conn,
+		db:   db,
+		Account: Policy{
+			FreeAttempts: 5,
+			BaseDelay:    time.Second,
+			MaxDelay:     15 * time.Minute,
+			ResetAfter:   24 * time.Hour,
+		},
+		IP: Policy{
+			FreeAttempts: 20,
+			BaseDelay:    time.Second,
+			MaxDelay:     15 * time.Minute,
+			ResetAfter:   24 * time.Hour,
+		},
+	}
+}
+
+// NewMailLimiter returns a limiter for requests that email an account, like
+// sign in links and password resets. It starts backing off an email after 3
+// requests and an address after 10, holding either off for up to an hour at
+// a time. Every request counts, none are taken back.
+func NewMailLimiter(conn *sql.DB, db *database.Queries) *Limiter {
+	return &Limiter{
+		conn:   conn,
+		db:     db,
+		prefix: "mail_",
+		Account: Policy{
+			FreeAttempts: 3,
+			BaseDelay:    time.Minute,
+			MaxDelay:     time.Hour,
+			ResetAfter:   24 * time.Hour,
+		},
+		IP: Policy{
+			FreeAttempts: 10,
+			BaseDelay:    time.Minute,
+			MaxDelay:     time.Hour,
+			ResetAfter:   24 * time.Hour,
+		},
+	}
+}
+
+// NewCodeLimiter returns a limiter for requests that look up short codes
+// users type in, like the user codes of device authorization, so they
+// can't be guessed. Only addresses are limited, starting to back off
+// after 10 codes that weren't found and holding off for up to 15 minutes
+// at a time.
+func NewCodeLimiter(conn *sql.DB, db *database.Queries) *Limiter {
+	return &Limiter{
+		conn:   conn,
+		db:     db,
+		prefix: "code_",
+		IP: Policy{
+			FreeAttempts: 10,
+			BaseDelay:    time.Second,
+			MaxDelay:     15 * time.Minute,
+			ResetAfter:   24 * time.Hour,
+		},
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Attempt starts a login to the account with email from ip. It returns
+// when a login will next be allowed, or the zero time if it is allowed
+// now, in which case the attempt has already been recorded as a failure.
+// Checking and recording happen together, so a burst of parallel attempts
+// can't all get in before the first of them fails. Call Succeed if the
+// login succeeds.
+func (l *Limiter) Attempt(ctx context.Context, email, ip string) (time.Time, error) {
+	// Lock the account's counter first so concurrent attempts can't deadlock
+	return l.attempt(ctx, []counter{
+		{l.Account, l.prefix + scopeAccount, normalizeEmail(email)},
+		{l.IP, l.prefix + scopeIP, ip},
+	})
+}
+
+// AttemptFrom is Attempt for requests that aren't for any one account, only
+// the counter for ip is checked and recorded. Call SucceedFrom if the
+// request succeeds.
+func (l *Limiter) AttemptFrom(ctx context.Context, ip string) (time.Time, error) {
+	return l.attempt(ctx, []counter{{l.IP, l.prefix + scopeIP, ip}})
+}
+
+// counter is a count of failures under policy
+type counter struct {
+	policy            Policy
+	scope, identifier string
+}
+
+func (l *Limiter) attempt(ctx context.Context, counters []counter) (time.Time, error) {
+	tx, err := l.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback()
+	qtx := l.db.WithTx(tx)
+
+	// Lock the counters until the attempt is recorded
+	var retryAt time.Time
+	for _, c := range counters {
+		failure, err := qtx.LockLoginFailure(ctx, database.LockLoginFailureParams{
+			Scope:      c.scope,
+			Identifier: c.identifier,
+		})
+		if err != nil {
+			return time.Time{}, err
+		}
+		lockedUntil := c.policy.LockedUntil(int(failure.Failures), failure.LastFailedAt)
+		if time.Now().Before(lockedUntil) && lockedUntil.After(retryAt) {
+			retryAt = lockedUntil
+		}
+	}
+	if !retryAt.IsZero() {
+		return retryAt, nil
+	}
+
+	for _, c := range counters {
+		err = qtx.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+			Scope:       c.scope,
+			Identifier:  c.identifier,
+			ResetBefore: time.Now().Add(-c.policy.ResetAfter),
+		})
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Time{}, tx.Commit()
+}
+
+// Succeed takes back the failure Attempt recorded for a login that
+// succeeded. The account's failures are forgotten, while the address only
+// gets this attempt back.
+func (l *Limiter) Succeed(ctx context.Context, email, ip string) error {
+	err := l.UnlockAccount(ctx, email)
+	if err != nil {
+		return err
+	}
+	return l.SucceedFrom(ctx, ip)
+}
+
+// SucceedFrom takes back the failure AttemptFrom recorded for a request
+// from ip that succeeded
+func (l *Limiter) SucceedFrom(ctx context.Context, ip string) error {
+	return l.db.RefundLoginFailure(ctx, database.RefundLoginFailureParams{
+		Scope:      l.prefix + scopeIP,
+		Identifier: ip,
+	})
+}
+
+// Fail records a failed login to the account with email from ip, for
+// failures that come after an attempt succeeded
+func (l *Limiter) Fail(ctx context.Context, email, ip string) error {
+	err := l.db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Scope:       l.prefix + scopeAccount,
+		Identifier:  normalizeEmail(email),
+		ResetBefore: time.Now().Add(-l.Account.ResetAfter),
+	})
+	if err != nil {
+		return err
+	}
+	return l.db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Scope:       l.prefix + scopeIP,
+		Identifier:  ip,
+		ResetBefore: time.Now().Add(-l.IP.ResetAfter),
+	})
+}
+
+// UnlockAccount forgets the failed logins to the account with email. A
+// successful login does the same, failures from its address are kept.
+func (l *Limiter) UnlockAccount(ctx context.Context, email string) error {
+	return l.db.ClearLoginFailures(ctx, database.ClearLoginFailuresParams{
+		Scope:      l.prefix + scopeAccount,
+		Identifier: normalizeEmail(email),
+	})
+}
+
+// UnlockIP forgets the failed logins from ip
+func (l *Limiter) UnlockIP(ctx context.Context, ip string) error {
+	return l.db.ClearLoginFailures(ctx, database.ClearLoginFailuresParams{
+		Scope:      l.prefix + scopeIP,
+		Identifier: ip,
+	})
+}
+
+// Prune deletes failures old enough to have been forgotten
+func (l *Limiter) Prune(ctx context.Context) error {
+	resetAfter := max(l.Account.ResetAfter, l.IP.ResetAfter)
+	_, err := l.db.DeleteStaleLoginFailures(ctx, database.DeleteStaleLoginFailuresParams{
+		LastFailedAt: time.Now().Add(-resetAfter),
+		Scopes:       []string{l.prefix + scopeAccount, l.prefix + scopeIP},
+	})
+	return err
+}
+
+// Run prunes old failures every interval until ctx is done
+func (l *Limiter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.Prune(ctx); err != nil {
+				log.Printf("unable to prune login failures: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package throttle
+
+import "time"
+
+// Policy says how long to hold off logins after repeated failures. The
+// first FreeAttempts failures cost nothing, after that each failure
+// doubles the wait starting from BaseDelay, up to MaxDelay. Failures are
+// forgotten once none have happened for ResetAfter.
+type Policy struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	ResetAfter   time.Duration
+}
+
+// LockedUntil returns when the next attempt is allowed after failures
+// failed attempts, the last of them at lastFailure. It is the zero time
+// when attempts aren't being held off.
+func (p Policy) LockedUntil(failures int, lastFailure time.Time) time.Time {
+	if failures <= p.FreeAttempts {
+		return time.Time{}
+	}
+	delay := p.MaxDelay
+	// Shifting by more than 32 overflows long before it matters
+	if n := failures - p.FreeAttempts - 1; n < 32 {
+		if d := p.BaseDelay << n; d > 0 && d < p.MaxDelay {
+			delay = d
+		}
+	}
+	return lastFailure.Add(delay)
+}
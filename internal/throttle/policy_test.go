@@ -0,0 +1,40 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockedUntil(t *testing.T) {
+	p := Policy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+	}
+	last := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{failures: 0},
+		{failures: 3},
+		{failures: 4, expected: time.Second},
+		{failures: 5, expected: 2 * time.Second},
+		{failures: 8, expected: 16 * time.Second},
+		{failures: 10, expected: time.Minute},
+		{failures: 1000, expected: time.Minute},
+	}
+	for _, tc := range cases {
+		got := p.LockedUntil(tc.failures, last)
+		if tc.expected == 0 {
+			if !got.IsZero() {
+				t.Errorf("%d failures: expected no lock, got %v", tc.failures, got)
+			}
+			continue
+		}
+		if !got.Equal(last.Add(tc.expected)) {
+			t.Errorf("%d failures: expected lock for %v, got %v", tc.failures, tc.expected, got.Sub(last))
+		}
+	}
+}
@@ -1,21 +1,37 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"sync/atomic"
+	"time"
 
+	"github.com/alexedwards/argon2id"
+	"github.com/evanwiseman/chirpy/internal/auth"
 	"github.com/evanwiseman/chirpy/internal/database"
 	"github.com/evanwiseman/chirpy/internal/handlers"
+	"github.com/evanwiseman/chirpy/internal/mail"
+	"github.com/evanwiseman/chirpy/internal/oidc"
+	"github.com/evanwiseman/chirpy/internal/passwords"
+	"github.com/evanwiseman/chirpy/internal/revocation"
+	"github.com/evanwiseman/chirpy/internal/throttle"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
 const (
-	serverPort     = "8080"
-	fileServerPath = "."
+	serverPort                  = "8080"
+	fileServerPath              = "."
+	revocationSyncInterval      = 30 * time.Second
+	loginFailurePruneInterval   = time.Hour
+	oidcLoginStatePruneInterval = time.Hour
+	defaultMailFrom             = "Chirpy <no-reply@chirpy.local>"
+	defaultAppURL               = "http://localhost:" + serverPort + "/app"
+	defaultOIDCRedirectURL      = "http://localhost:" + serverPort + "/api/login/oidc/callback"
 )
 
 func main() {
@@ -29,13 +45,138 @@ func main() {
 		log.Fatalf("failed to open database %v", dbURL)
 	}
 
+	// Load the JWT signing keys, falling back to an HMAC secret when no key
+	// directory is configured
+	keys := auth.NewHMACKeyring(os.Getenv("JWT_SECRET"))
+	if keysDir := os.Getenv("JWT_KEYS_DIR"); keysDir != "" {
+		keys, err = auth.LoadKeyring(keysDir)
+		if err != nil {
+			log.Fatalf("failed to load jwt keys: %v", err)
+		}
+		// Keep accepting tokens signed with the old secret until they expire
+		if secret := os.Getenv("JWT_SECRET"); secret != "" {
+			keys.AllowHMAC(secret)
+		}
+	}
+
+	// Load revoked access tokens and keep them in sync with the database
+	queries := database.New(db)
+	revokedTokens := revocation.NewStore(queries)
+	if err := revokedTokens.Sync(context.Background()); err != nil {
+		log.Fatalf("failed to load revoked access tokens: %v", err)
+	}
+	go revokedTokens.Run(context.Background(), revocationSyncInterval)
+	keys.SetDenylist(revokedTokens)
+
+	// Track failed logins, forgetting them once they are old enough
+	loginLimiter := throttle.NewLimiter(db, queries)
+	go loginLimiter.Run(context.Background(), loginFailurePruneInterval)
+
+	// Limit how often sign in links and password resets can be mailed
+	mailLimiter := throttle.NewMailLimiter(db, queries)
+	go mailLimiter.Run(context.Background(), loginFailurePruneInterval)
+
+	// Limit how many device user codes an address can try
+	codeLimiter := throttle.NewCodeLimiter(db, queries)
+	go codeLimiter.Run(context.Background(), loginFailurePruneInterval)
+
+	// Deliver mail over SMTP when configured, otherwise write it to a log
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = defaultMailFrom
+	}
+	var mailer mail.Mailer = &mail.LogMailer{From: mailFrom, Out: os.Stdout}
+	if smtpAddr := os.Getenv("SMTP_ADDR"); smtpAddr != "" {
+		mailer = &mail.SMTPMailer{
+			Addr:     smtpAddr,
+			From:     mailFrom,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	} else if mailLog := os.Getenv("MAIL_LOG_FILE"); mailLog != "" {
+		f, err := os.OpenFile(mailLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Fatalf("failed to open mail log: %v", err)
+		}
+		defer f.Close()
+		mailer = &mail.LogMailer{From: mailFrom, Out: f}
+	}
+
+	// Links in emails open the web app
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = defaultAppURL
+	}
+
+	// Let users sign in with an OpenID Connect provider when one is
+	// configured
+	var oidcProvider *oidc.Provider
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+		if redirectURL == "" {
+			redirectURL = defaultOIDCRedirectURL
+		}
+		oidcProvider = oidc.NewProvider(oidc.Config{
+			Issuer:       issuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  redirectURL,
+		}, nil)
+	}
+
+	// Hash passwords with the configured argon2id parameters, hashes made
+	// with weaker ones are upgraded as users log in
+	argon2Params := *argon2id.DefaultParams
+	argon2Params.Memory = uint32(envInt("ARGON2_MEMORY_KIB", int(argon2Params.Memory)))
+	argon2Params.Iterations = uint32(envInt("ARGON2_ITERATIONS", int(argon2Params.Iterations)))
+	parallelism := envInt("ARGON2_PARALLELISM", int(argon2Params.Parallelism))
+	if argon2Params.Iterations < 1 || parallelism < 1 || parallelism > 255 {
+		log.Fatalf("ARGON2_ITERATIONS must be at least 1 and ARGON2_PARALLELISM 1-255")
+	}
+	argon2Params.Parallelism = uint8(parallelism)
+	auth.SetPasswordParams(&argon2Params)
+	if err := handlers.InitDummyPasswordHash(); err != nil {
+		log.Fatalf("failed to hash dummy password: %v", err)
+	}
+
+	// New passwords must meet the password policy, and not be in the
+	// breached password corpus when one is configured
+	passwordPolicy := passwords.Policy{
+		MinLength:  envInt("PASSWORD_MIN_LENGTH", passwords.DefaultMinLength),
+		MaxLength:  passwords.DefaultMaxLength,
+		MinEntropy: float64(envInt("PASSWORD_MIN_ENTROPY", passwords.DefaultMinEntropy)),
+	}
+	if breachedDir := os.Getenv("BREACHED_PASSWORDS_DIR"); breachedDir != "" {
+		passwordPolicy.Breached, err = passwords.OpenCorpus(breachedDir)
+		if err != nil {
+			log.Fatalf("failed to open breached passwords: %v", err)
+		}
+	}
+
 	// Create API Config
 	apiCfg := handlers.APIConfig{
-		DB:             database.New(db),
+		DB:             queries,
+		Conn:           db,
 		FileServerHits: atomic.Int32{},
 		Platform:       os.Getenv("PLATFORM"),
-		JWTSecret:      os.Getenv("JWT_SECRET"),
+		Keys:           keys,
+		RevokedTokens:  revokedTokens,
+		Mailer:         mailer,
+		LoginLimiter:   loginLimiter,
+		MailLimiter:    mailLimiter,
+		CodeLimiter:    codeLimiter,
+		OIDC:           oidcProvider,
+		PasswordPolicy: passwordPolicy,
 		PolkaKey:       os.Getenv("POLKA_KEY"),
+		AdminKey:       os.Getenv("ADMIN_API_KEY"),
+		AppURL:         appURL,
+
+		RequireVerifiedEmail: os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true",
+	}
+
+	// Forget sign ins with the identity provider that were never completed
+	if oidcProvider != nil {
+		go apiCfg.RunOIDCLoginStatePruning(context.Background(), oidcLoginStatePruneInterval)
 	}
 
 	serveMux := http.NewServeMux()
@@ -49,26 +190,81 @@ func main() {
 
 	serveMux.HandleFunc("GET /admin/metrics", apiCfg.HandlerGetMetrics)
 	serveMux.HandleFunc("POST /admin/reset", apiCfg.HandlerPostReset)
+	serveMux.HandleFunc("POST /admin/users/{userID}/unlock", apiCfg.HandlerUnlockUser)
+	serveMux.HandleFunc("POST /admin/ips/{ip}/unlock", apiCfg.HandlerUnlockIP)
 
 	serveMux.HandleFunc("GET /api/healthz", handlers.HandlerHealthz)
+	serveMux.HandleFunc("GET /.well-known/jwks.json", apiCfg.HandlerJWKS)
 
 	serveMux.HandleFunc("POST /api/users", apiCfg.HandlerPostUsers)
 	serveMux.HandleFunc("PUT /api/users", apiCfg.HandlerPutUsers)
+	serveMux.HandleFunc("POST /api/users/verify", apiCfg.HandlerVerifyEmail)
+	serveMux.HandleFunc("POST /api/users/verify/resend", apiCfg.HandlerResendVerification)
+	serveMux.HandleFunc("PATCH /api/users/me/profile", apiCfg.HandlerPatchProfile)
+	serveMux.HandleFunc("GET /api/users/{handle}", apiCfg.HandlerGetProfile)
 	serveMux.HandleFunc("POST /api/login", apiCfg.HandlerLogin)
+	serveMux.HandleFunc("POST /api/login/mfa", apiCfg.HandlerLoginMFA)
+	serveMux.HandleFunc("POST /api/login/magic", apiCfg.HandlerRequestMagicLink)
+	serveMux.HandleFunc("POST /api/login/magic/consume", apiCfg.HandlerConsumeMagicLink)
+	serveMux.HandleFunc("GET /api/login/oidc", apiCfg.HandlerOIDCLogin)
+	serveMux.HandleFunc("GET /api/login/oidc/callback", apiCfg.HandlerOIDCCallback)
+	serveMux.HandleFunc("POST /api/users/me/2fa/totp", apiCfg.HandlerEnrollTOTP)
+	serveMux.HandleFunc("POST /api/users/me/2fa/totp/confirm", apiCfg.HandlerConfirmTOTP)
+	serveMux.HandleFunc("POST /api/password/forgot", apiCfg.HandlerForgotPassword)
+	serveMux.HandleFunc("POST /api/password/reset", apiCfg.HandlerResetPassword)
+
+	serveMux.HandleFunc("POST /api/users/{userID}/follow", apiCfg.HandlerPostFollow)
+	serveMux.HandleFunc("DELETE /api/users/{userID}/follow", apiCfg.HandlerDeleteFollow)
+	serveMux.HandleFunc("GET /api/users/{userID}/followers", apiCfg.HandlerGetFollowers)
+	serveMux.HandleFunc("GET /api/users/{userID}/following", apiCfg.HandlerGetFollowing)
+	serveMux.HandleFunc("GET /api/timeline", apiCfg.HandlerGetTimeline)
+	serveMux.HandleFunc("GET /api/users/me/mentions", apiCfg.HandlerGetMentions)
 
 	serveMux.HandleFunc("POST /api/chirps", apiCfg.HandlerPostChirps)
 	serveMux.HandleFunc("GET /api/chirps", apiCfg.HandlerGetChirps)
 	serveMux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.HandlerGetChripByID)
+	serveMux.HandleFunc("PUT /api/chirps/{chirpID}", apiCfg.HandlerPutChirpByID)
+	serveMux.HandleFunc("PATCH /api/chirps/{chirpID}", apiCfg.HandlerPutChirpByID)
 	serveMux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.HandlerDeleteChirpByID)
+	serveMux.HandleFunc("GET /api/chirps/{chirpID}/history", apiCfg.HandlerGetChirpHistory)
+	serveMux.HandleFunc("GET /api/chirps/{chirpID}/thread", apiCfg.HandlerGetChirpThread)
+	serveMux.HandleFunc("POST /api/chirps/{chirpID}/like", apiCfg.HandlerPostChirpLike)
+	serveMux.HandleFunc("DELETE /api/chirps/{chirpID}/like", apiCfg.HandlerDeleteChirpLike)
+	serveMux.HandleFunc("POST /api/chirps/{chirpID}/rechirp", apiCfg.HandlerPostRechirp)
+	serveMux.HandleFunc("DELETE /api/chirps/{chirpID}/rechirp", apiCfg.HandlerDeleteRechirp)
+
+	serveMux.HandleFunc("GET /api/hashtags/{tag}/chirps", apiCfg.HandlerGetHashtagChirps)
+	serveMux.HandleFunc("GET /api/search/chirps", apiCfg.HandlerSearchChirps)
 
 	serveMux.HandleFunc("POST /api/refresh", apiCfg.HandlerRefresh)
 	serveMux.HandleFunc("POST /api/revoke", apiCfg.HandlerRevoke)
+	serveMux.HandleFunc("POST /api/logout", apiCfg.HandlerLogout)
+
+	serveMux.HandleFunc("GET /api/sessions", apiCfg.HandlerGetSessions)
+	serveMux.HandleFunc("DELETE /api/sessions/{sessionID}", apiCfg.HandlerDeleteSession)
+	serveMux.HandleFunc("POST /api/sessions/revoke-all", apiCfg.HandlerRevokeAllSessions)
+
+	serveMux.HandleFunc("POST /api/tokens", apiCfg.HandlerCreateAccessToken)
+	serveMux.HandleFunc("GET /api/tokens", apiCfg.HandlerGetAccessTokens)
+	serveMux.HandleFunc("DELETE /api/tokens/{tokenID}", apiCfg.HandlerDeleteAccessToken)
+
+	serveMux.HandleFunc("POST /api/oauth/clients", apiCfg.HandlerCreateOAuthClient)
+	serveMux.HandleFunc("GET /api/oauth/clients", apiCfg.HandlerGetOAuthClients)
+	serveMux.HandleFunc("DELETE /api/oauth/clients/{clientID}", apiCfg.HandlerDeleteOAuthClient)
+	serveMux.HandleFunc("GET /oauth/authorize", apiCfg.HandlerGetAuthorize)
+	serveMux.HandleFunc("POST /oauth/authorize", apiCfg.HandlerPostAuthorize)
+	serveMux.HandleFunc("POST /oauth/device/code", apiCfg.HandlerOAuthDeviceCode)
+	serveMux.HandleFunc("GET /oauth/device", apiCfg.HandlerGetDevice)
+	serveMux.HandleFunc("POST /oauth/device", apiCfg.HandlerPostDevice)
+	serveMux.HandleFunc("POST /oauth/token", apiCfg.HandlerOAuthToken)
+	serveMux.HandleFunc("POST /oauth/revoke", apiCfg.HandlerOAuthRevoke)
+	serveMux.HandleFunc("POST /oauth/introspect", apiCfg.HandlerOAuthIntrospect)
 
 	serveMux.HandleFunc("POST /api/polka/webhooks", apiCfg.HandlerUpgradeUserChirpyRed)
 
 	// Create the server at the desired port and attach the serve mux
 	server := http.Server{
-		Handler: serveMux,
+		Handler: apiCfg.MiddlewareCSRF(serveMux),
 		Addr:    ":" + serverPort,
 	}
 
@@ -76,3 +272,17 @@ func main() {
 	log.Printf("Serving files from %s on port: %s\n", fileServerPath, serverPort)
 	log.Fatal(server.ListenAndServe())
 }
+
+// envInt returns the integer in the environment variable name, or fallback
+// when it isn't set
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Fatalf("%s must be a non-negative integer, got %q", name, value)
+	}
+	return n
+}
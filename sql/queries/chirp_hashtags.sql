@@ -0,0 +1,32 @@
+-- name: CreateChirpHashtags :exec
+INSERT INTO chirp_hashtags (chirp_id, tag, position)
+SELECT sqlc.arg('chirp_id')::uuid, t.tag, t.position
+FROM unnest(sqlc.arg('tags')::text[]) WITH ORDINALITY AS t(tag, position)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteChirpHashtags :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = $1;
+
+-- name: GetChirpHashtags :many
+SELECT * FROM chirp_hashtags
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+ORDER BY chirp_id, position;
+
+-- name: ListHashtagChirpsAsc :many
+SELECT chirps.* FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+WHERE chirp_hashtags.tag = sqlc.arg('tag')
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListHashtagChirpsDesc :many
+SELECT chirps.* FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+WHERE chirp_hashtags.tag = sqlc.arg('tag')
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,34 @@
+-- name: CreateChirpMentions :exec
+INSERT INTO chirp_mentions (chirp_id, user_id, start_index, length)
+SELECT sqlc.arg('chirp_id')::uuid, m.user_id, m.start_index, m.length
+FROM unnest(
+    sqlc.arg('user_ids')::uuid[],
+    sqlc.arg('start_indexes')::integer[],
+    sqlc.arg('lengths')::integer[]
+) AS m(user_id, start_index, length)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteChirpMentions :exec
+DELETE FROM chirp_mentions
+WHERE chirp_id = $1;
+
+-- name: GetChirpMentions :many
+SELECT * FROM chirp_mentions
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+ORDER BY chirp_id, start_index;
+
+-- name: ListMentionChirpsAsc :many
+SELECT * FROM chirps
+WHERE id IN (SELECT chirp_id FROM chirp_mentions WHERE chirp_mentions.user_id = sqlc.arg('user_id'))
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListMentionChirpsDesc :many
+SELECT * FROM chirps
+WHERE id IN (SELECT chirp_id FROM chirp_mentions WHERE chirp_mentions.user_id = sqlc.arg('user_id'))
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,37 @@
+-- name: SearchChirpsAsc :many
+WITH matches AS (
+    SELECT id, (ts_rank(to_tsvector('english'::regconfig, body), to_tsquery('english', sqlc.arg('query'))) * 1000000)::bigint AS rank
+    FROM chirps
+    WHERE to_tsvector('english'::regconfig, body) @@ to_tsquery('english', sqlc.arg('query'))
+      AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+      AND (sqlc.narg('since')::timestamp IS NULL OR created_at >= sqlc.narg('since')::timestamp)
+      AND (sqlc.narg('until')::timestamp IS NULL OR created_at < sqlc.narg('until')::timestamp)
+)
+SELECT sqlc.embed(chirps), matches.rank,
+    ts_headline('english', chirps.body, to_tsquery('english', sqlc.arg('query')),
+        'StartSel=' || chr(57344) || ', StopSel=' || chr(57345) || ', MaxFragments=2, MaxWords=20, MinWords=5')::text AS snippet
+FROM matches
+JOIN chirps ON chirps.id = matches.id
+WHERE sqlc.narg('cursor_rank')::bigint IS NULL
+    OR (matches.rank, chirps.created_at, chirps.id) > (sqlc.narg('cursor_rank')::bigint, sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+ORDER BY matches.rank ASC, chirps.created_at ASC, chirps.id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: SearchChirpsDesc :many
+WITH matches AS (
+    SELECT id, (ts_rank(to_tsvector('english'::regconfig, body), to_tsquery('english', sqlc.arg('query'))) * 1000000)::bigint AS rank
+    FROM chirps
+    WHERE to_tsvector('english'::regconfig, body) @@ to_tsquery('english', sqlc.arg('query'))
+      AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+      AND (sqlc.narg('since')::timestamp IS NULL OR created_at >= sqlc.narg('since')::timestamp)
+      AND (sqlc.narg('until')::timestamp IS NULL OR created_at < sqlc.narg('until')::timestamp)
+)
+SELECT sqlc.embed(chirps), matches.rank,
+    ts_headline('english', chirps.body, to_tsquery('english', sqlc.arg('query')),
+        'StartSel=' || chr(57344) || ', StopSel=' || chr(57345) || ', MaxFragments=2, MaxWords=20, MinWords=5')::text AS snippet
+FROM matches
+JOIN chirps ON chirps.id = matches.id
+WHERE sqlc.narg('cursor_rank')::bigint IS NULL
+    OR (matches.rank, chirps.created_at, chirps.id) < (sqlc.narg('cursor_rank')::bigint, sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+ORDER BY matches.rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
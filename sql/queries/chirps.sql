@@ -1,22 +1,74 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to, root_id, quote_of)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: CreateRechirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, rechirp_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    $1,
     $2
 )
+ON CONFLICT (user_id, rechirp_of) WHERE rechirp_of IS NOT NULL DO NOTHING
 RETURNING *;
 
--- name: GetChirps :many
+-- name: GetRechirp :one
+SELECT * FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2;
+
+-- name: DeleteRechirp :one
+DELETE FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2
+RETURNING *;
+
+-- name: GetChirpsByIDs :many
+SELECT * FROM chirps
+WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+-- name: ListChirpsAsc :many
+SELECT * FROM chirps
+WHERE (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsDesc :many
+SELECT * FROM chirps
+WHERE (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsTopAsc :many
 SELECT * FROM chirps
-ORDER BY created_at ASC;
+WHERE (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('cursor_like_count')::integer IS NULL
+    OR (like_count, created_at, id) > (sqlc.narg('cursor_like_count')::integer, sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY like_count ASC, created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
 
--- name: GetChripsByUserID :many
+-- name: ListChirpsTopDesc :many
 SELECT * FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC;
+WHERE (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('cursor_like_count')::integer IS NULL
+    OR (like_count, created_at, id) < (sqlc.narg('cursor_like_count')::integer, sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY like_count DESC, created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
 
 -- name: GetChirp :one
 SELECT * FROM chirps
@@ -24,4 +76,122 @@ WHERE $1 = chirps.id;
 
 -- name: DeleteChirp :exec
 DELETE FROM chirps
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: GetChirpForUpdate :one
+SELECT * FROM chirps
+WHERE id = $1
+FOR UPDATE;
+
+-- name: UpdateChirp :one
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+
+-- name: IncrementChirpReplyCount :exec
+UPDATE chirps
+SET reply_count = reply_count + 1
+WHERE id = $1;
+
+-- name: DecrementChirpReplyCount :exec
+UPDATE chirps
+SET reply_count = GREATEST(reply_count - 1, 0)
+WHERE id = $1;
+
+-- name: IncrementChirpLikeCount :one
+UPDATE chirps
+SET like_count = like_count + 1
+WHERE id = $1
+RETURNING *;
+
+-- name: DecrementChirpLikeCount :one
+UPDATE chirps
+SET like_count = GREATEST(like_count - 1, 0)
+WHERE id = $1
+RETURNING *;
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.* FROM chirps parent
+    JOIN chirps child ON child.in_reply_to = parent.id
+    WHERE child.id = $1
+    UNION ALL
+    SELECT c.* FROM chirps c
+    JOIN ancestors a ON c.id = a.in_reply_to
+)
+SELECT * FROM ancestors
+ORDER BY created_at ASC, id ASC;
+
+-- name: ListChirpDescendantsForward :many
+WITH RECURSIVE descendants AS (
+    SELECT c.*, 1 AS depth, ARRAY[
+        (lpad((CASE WHEN sqlc.arg('newest_first')::boolean
+            THEN 9000000000000000000 - (extract(epoch FROM c.created_at) * 1000000)::bigint
+            ELSE (extract(epoch FROM c.created_at) * 1000000)::bigint
+        END)::text, 19, '0') || c.id::text) COLLATE "C"
+    ] AS path
+    FROM chirps c
+    WHERE c.in_reply_to = sqlc.arg('chirp_id')
+    UNION ALL
+    SELECT c.*, d.depth + 1, d.path || (
+        (lpad((CASE WHEN sqlc.arg('newest_first')::boolean
+            THEN 9000000000000000000 - (extract(epoch FROM c.created_at) * 1000000)::bigint
+            ELSE (extract(epoch FROM c.created_at) * 1000000)::bigint
+        END)::text, 19, '0') || c.id::text) COLLATE "C"
+    )
+    FROM chirps c
+    JOIN descendants d ON c.in_reply_to = d.id
+    WHERE d.depth < sqlc.arg('max_depth')
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of FROM descendants
+WHERE sqlc.narg('cursor_id')::uuid IS NULL
+    OR path > (SELECT path FROM descendants WHERE id = sqlc.narg('cursor_id')::uuid)
+ORDER BY path ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpDescendantsBackward :many
+WITH RECURSIVE descendants AS (
+    SELECT c.*, 1 AS depth, ARRAY[
+        (lpad((CASE WHEN sqlc.arg('newest_first')::boolean
+            THEN 9000000000000000000 - (extract(epoch FROM c.created_at) * 1000000)::bigint
+            ELSE (extract(epoch FROM c.created_at) * 1000000)::bigint
+        END)::text, 19, '0') || c.id::text) COLLATE "C"
+    ] AS path
+    FROM chirps c
+    WHERE c.in_reply_to = sqlc.arg('chirp_id')
+    UNION ALL
+    SELECT c.*, d.depth + 1, d.path || (
+        (lpad((CASE WHEN sqlc.arg('newest_first')::boolean
+            THEN 9000000000000000000 - (extract(epoch FROM c.created_at) * 1000000)::bigint
+            ELSE (extract(epoch FROM c.created_at) * 1000000)::bigint
+        END)::text, 19, '0') || c.id::text) COLLATE "C"
+    )
+    FROM chirps c
+    JOIN descendants d ON c.in_reply_to = d.id
+    WHERE d.depth < sqlc.arg('max_depth')
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, root_id, reply_count, like_count, quote_of, rechirp_of FROM descendants
+WHERE sqlc.narg('cursor_id')::uuid IS NULL
+    OR path < (SELECT path FROM descendants WHERE id = sqlc.narg('cursor_id')::uuid)
+ORDER BY path DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListTimelineAsc :many
+SELECT chirps.* FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = sqlc.arg('user_id')
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListTimelineDesc :many
+SELECT chirps.* FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = sqlc.arg('user_id')
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
\ No newline at end of file
@@ -0,0 +1,44 @@
+-- name: CreateFollow :exec
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES (
+    $1,
+    $2,
+    NOW()
+)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteFollow :execrows
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: ListFollowersAsc :many
+SELECT * FROM follows
+WHERE followee_id = sqlc.arg('user_id')
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, follower_id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, follower_id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListFollowersDesc :many
+SELECT * FROM follows
+WHERE followee_id = sqlc.arg('user_id')
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, follower_id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, follower_id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListFollowingAsc :many
+SELECT * FROM follows
+WHERE follower_id = sqlc.arg('user_id')
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, followee_id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, followee_id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListFollowingDesc :many
+SELECT * FROM follows
+WHERE follower_id = sqlc.arg('user_id')
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, followee_id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, followee_id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,33 @@
+-- name: GetLoginFailure :one
+SELECT * FROM login_failures
+WHERE scope = $1 AND identifier = $2;
+
+-- name: RecordLoginFailure :exec
+INSERT INTO login_failures (scope, identifier, failures, last_failed_at)
+VALUES ($1, $2, 1, NOW())
+ON CONFLICT (scope, identifier) DO UPDATE
+SET failures = CASE
+        WHEN login_failures.last_failed_at < sqlc.arg('reset_before') THEN 1
+        ELSE login_failures.failures + 1
+    END,
+    last_failed_at = NOW();
+
+-- name: LockLoginFailure :one
+INSERT INTO login_failures (scope, identifier, failures, last_failed_at)
+VALUES ($1, $2, 0, NOW())
+ON CONFLICT (scope, identifier) DO UPDATE
+SET failures = login_failures.failures
+RETURNING *;
+
+-- name: RefundLoginFailure :exec
+UPDATE login_failures
+SET failures = failures - 1
+WHERE scope = $1 AND identifier = $2 AND failures > 0;
+
+-- name: ClearLoginFailures :exec
+DELETE FROM login_failures
+WHERE scope = $1 AND identifier = $2;
+
+-- name: DeleteStaleLoginFailures :execrows
+DELETE FROM login_failures
+WHERE last_failed_at < $1 AND scope = ANY(sqlc.arg('scopes')::text[]);
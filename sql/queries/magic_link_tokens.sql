@@ -0,0 +1,13 @@
+-- name: CreateMagicLinkToken :exec
+INSERT INTO magic_link_tokens (token_hash, user_id, email, created_at, expires_at)
+VALUES ($1, $2, $3, NOW(), $4);
+
+-- name: GetMagicLinkTokenForUpdate :one
+SELECT * FROM magic_link_tokens
+WHERE token_hash = $1
+FOR UPDATE;
+
+-- name: UseMagicLinkTokens :exec
+UPDATE magic_link_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
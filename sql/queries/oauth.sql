@@ -0,0 +1,90 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, user_id, name, secret_hash, redirect_uris, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1;
+
+-- name: ListOAuthClients :many
+SELECT * FROM oauth_clients
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1 AND user_id = $2;
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, family_id, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    NOW(),
+    $8
+);
+
+-- name: GetOAuthAuthorizationCodeForUpdate :one
+SELECT * FROM oauth_authorization_codes
+WHERE code_hash = $1
+FOR UPDATE;
+
+-- name: UseOAuthAuthorizationCode :exec
+UPDATE oauth_authorization_codes
+SET used_at = NOW()
+WHERE code_hash = $1;
+
+-- name: CreateOAuthDeviceCode :exec
+INSERT INTO oauth_device_codes (device_code_hash, user_code, client_id, scopes, family_id, poll_interval, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    NOW(),
+    $7
+);
+
+-- name: GetOAuthDeviceCodeByUserCode :one
+SELECT * FROM oauth_device_codes
+WHERE user_code = $1;
+
+-- name: GetOAuthDeviceCodeForUpdate :one
+SELECT * FROM oauth_device_codes
+WHERE device_code_hash = $1
+FOR UPDATE;
+
+-- name: ApproveOAuthDeviceCode :execrows
+UPDATE oauth_device_codes
+SET user_id = $2, approved_at = NOW()
+WHERE user_code = $1 AND approved_at IS NULL AND denied_at IS NULL AND expires_at > NOW();
+
+-- name: DenyOAuthDeviceCode :execrows
+UPDATE oauth_device_codes
+SET denied_at = NOW()
+WHERE user_code = $1 AND approved_at IS NULL AND denied_at IS NULL AND expires_at > NOW();
+
+-- name: PollOAuthDeviceCode :exec
+UPDATE oauth_device_codes
+SET last_polled_at = $2, poll_interval = $3
+WHERE device_code_hash = $1;
+
+-- name: UseOAuthDeviceCode :exec
+UPDATE oauth_device_codes
+SET used_at = NOW()
+WHERE device_code_hash = $1;
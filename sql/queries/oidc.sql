@@ -0,0 +1,20 @@
+-- name: CreateOIDCLoginState :exec
+INSERT INTO oidc_login_states (state_hash, nonce, code_verifier, created_at, expires_at)
+VALUES ($1, $2, $3, NOW(), $4);
+
+-- name: DeleteOIDCLoginState :one
+DELETE FROM oidc_login_states
+WHERE state_hash = $1
+RETURNING *;
+
+-- name: DeleteExpiredOIDCLoginStates :execrows
+DELETE FROM oidc_login_states
+WHERE expires_at < $1;
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE issuer = $1 AND subject = $2;
+
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities (issuer, subject, user_id, email, created_at)
+VALUES ($1, $2, $3, $4, NOW());
@@ -0,0 +1,13 @@
+-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens (token_hash, user_id, created_at, expires_at)
+VALUES ($1, $2, NOW(), $3);
+
+-- name: GetPasswordResetTokenForUpdate :one
+SELECT * FROM password_reset_tokens
+WHERE token_hash = $1
+FOR UPDATE;
+
+-- name: UsePasswordResetTokens :exec
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
@@ -1,12 +1,18 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip, last_used_at, client_id, scopes)
 VALUES(
     $1,
     NOW(),
     NOW(),
     $2,
     $3,
-    NULL
+    NULL,
+    $4,
+    $5,
+    $6,
+    NOW(),
+    $7,
+    $8
 )
 RETURNING *;
 
@@ -14,7 +20,41 @@ RETURNING *;
 SELECT * FROM refresh_tokens
 WHERE token = $1;
 
+-- name: GetRefreshTokenForUpdate :one
+SELECT * FROM refresh_tokens
+WHERE token = $1
+FOR UPDATE;
+
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET updated_at = NOW(), revoked_at = NOW()
 WHERE token = $1;
+
+-- name: RotateRefreshToken :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW(), replaced_by = $2
+WHERE token = $1;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: ListSessions :many
+SELECT family_id, user_agent, ip, last_used_at, expires_at,
+    (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = refresh_tokens.family_id)::timestamp AS signed_in_at
+FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+ORDER BY last_used_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeSessions :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = sqlc.arg('user_id')
+  AND revoked_at IS NULL
+  AND (sqlc.narg('except_family_id')::uuid IS NULL OR family_id <> sqlc.narg('except_family_id')::uuid);
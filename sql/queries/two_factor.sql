@@ -0,0 +1,42 @@
+-- name: StartTOTPEnrollment :execrows
+INSERT INTO totp_credentials (user_id, secret, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, created_at = NOW(), last_used_step = 0
+WHERE totp_credentials.confirmed_at IS NULL;
+
+-- name: GetTOTPCredential :one
+SELECT * FROM totp_credentials
+WHERE user_id = $1;
+
+-- name: GetTOTPCredentialForUpdate :one
+SELECT * FROM totp_credentials
+WHERE user_id = $1
+FOR UPDATE;
+
+-- name: ConfirmTOTPCredential :exec
+UPDATE totp_credentials
+SET confirmed_at = NOW(), last_used_step = $2
+WHERE user_id = $1;
+
+-- name: UseTOTPStep :exec
+UPDATE totp_credentials
+SET last_used_step = $2
+WHERE user_id = $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (id, user_id, code_hash, created_at)
+VALUES (gen_random_uuid(), $1, $2, NOW());
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
+
+-- name: GetUnusedRecoveryCodes :many
+SELECT * FROM recovery_codes
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL;
@@ -1,18 +1,23 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
 RETURNING *;
 
 -- name: UpdateUser :one
 UPDATE users
-SET email = $2, hashed_password = $3, updated_at = NOW()
-WHERE id = $1
+SET email = sqlc.arg('email'),
+    hashed_password = sqlc.arg('hashed_password'),
+    handle = COALESCE(sqlc.narg('handle'), handle),
+    email_verified_at = CASE WHEN email = sqlc.arg('email') THEN email_verified_at END,
+    updated_at = NOW()
+WHERE id = sqlc.arg('id')
 RETURNING *;
 
 -- name: UpgradeUserChirpyRed :one
@@ -26,4 +31,46 @@ DELETE FROM users;
 
 -- name: GetUserByEmail :one
 SELECT * FROM users
-WHERE email = $1;
\ No newline at end of file
+WHERE lower(email) = lower($1);
+
+-- name: GetUser :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: GetUsersByHandles :many
+SELECT * FROM users
+WHERE handle = ANY(sqlc.arg('handles')::text[]);
+
+-- name: UpdateUserProfile :one
+UPDATE users
+SET handle = $2,
+    display_name = $3,
+    bio = $4,
+    avatar_url = $5,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUserProfileByHandle :one
+SELECT id, created_at, handle, display_name, bio, avatar_url,
+    (SELECT COUNT(*) FROM chirps WHERE chirps.user_id = users.id) AS chirp_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.followee_id = users.id) AS follower_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.follower_id = users.id) AS following_count
+FROM users
+WHERE handle = $1;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: VerifyUserEmail :one
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2
+RETURNING *;
+
+-- name: RehashUserPassword :exec
+UPDATE users
+SET hashed_password = sqlc.arg('new_hashed_password')
+WHERE id = sqlc.arg('id') AND hashed_password = sqlc.arg('hashed_password');
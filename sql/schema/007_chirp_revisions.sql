@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE chirp_revisions (
+    id UUID PRIMARY KEY,
+    chirp_id UUID NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    replaced_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_chirp_id
+        FOREIGN KEY (chirp_id)
+        REFERENCES chirps(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chirp_revisions_chirp_id ON chirp_revisions (chirp_id, replaced_at);
+
+-- +goose Down
+DROP TABLE chirp_revisions;
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN in_reply_to UUID
+    CONSTRAINT fk_in_reply_to
+    REFERENCES chirps(id)
+    ON DELETE SET NULL,
+ADD COLUMN root_id UUID,
+ADD COLUMN reply_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_chirps_in_reply_to ON chirps (in_reply_to);
+CREATE INDEX idx_chirps_root_id ON chirps (root_id);
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN reply_count,
+DROP COLUMN root_id,
+DROP COLUMN in_reply_to;
@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE chirp_likes (
+    chirp_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, user_id),
+    CONSTRAINT fk_chirp_id
+        FOREIGN KEY (chirp_id)
+        REFERENCES chirps(id)
+        ON DELETE CASCADE,
+    CONSTRAINT fk_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chirp_likes_user_id ON chirp_likes (user_id);
+
+ALTER TABLE chirps
+ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_chirps_like_count_created_at_id ON chirps (like_count, created_at, id);
+
+-- +goose Down
+DROP INDEX idx_chirps_like_count_created_at_id;
+
+ALTER TABLE chirps
+DROP COLUMN like_count;
+
+DROP TABLE chirp_likes;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- No foreign keys so deleted chirps can still be shown as tombstones
+ALTER TABLE chirps
+ADD COLUMN quote_of UUID,
+ADD COLUMN rechirp_of UUID;
+
+CREATE UNIQUE INDEX idx_chirps_user_id_rechirp_of ON chirps (user_id, rechirp_of)
+    WHERE rechirp_of IS NOT NULL;
+
+-- +goose Down
+DROP INDEX idx_chirps_user_id_rechirp_of;
+
+ALTER TABLE chirps
+DROP COLUMN rechirp_of,
+DROP COLUMN quote_of;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE chirp_hashtags (
+    chirp_id UUID NOT NULL,
+    tag TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    PRIMARY KEY (chirp_id, tag),
+    CONSTRAINT fk_chirp_id
+        FOREIGN KEY (chirp_id)
+        REFERENCES chirps(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chirp_hashtags_tag ON chirp_hashtags (tag);
+
+-- +goose Down
+DROP TABLE chirp_hashtags;
@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN handle TEXT UNIQUE;
+
+CREATE TABLE chirp_mentions (
+    chirp_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    start_index INTEGER NOT NULL,
+    length INTEGER NOT NULL,
+    PRIMARY KEY (chirp_id, start_index),
+    CONSTRAINT fk_chirp_id
+        FOREIGN KEY (chirp_id)
+        REFERENCES chirps(id)
+        ON DELETE CASCADE,
+    CONSTRAINT fk_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chirp_mentions_user_id ON chirp_mentions (user_id, chirp_id);
+
+-- +goose Down
+DROP TABLE chirp_mentions;
+
+ALTER TABLE users
+DROP COLUMN handle;
@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN search TSVECTOR
+    GENERATED ALWAYS AS (to_tsvector('english'::regconfig, body)) STORED;
+
+CREATE INDEX idx_chirps_search ON chirps USING GIN (search);
+
+-- +goose Down
+DROP INDEX idx_chirps_search;
+
+ALTER TABLE chirps
+DROP COLUMN search;
@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD COLUMN family_id UUID,
+ADD COLUMN replaced_by TEXT;
+
+-- Every token issued before rotation starts its own family
+UPDATE refresh_tokens SET family_id = gen_random_uuid();
+
+ALTER TABLE refresh_tokens
+ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+
+-- +goose Down
+DROP INDEX idx_refresh_tokens_family_id;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN replaced_by,
+DROP COLUMN family_id;
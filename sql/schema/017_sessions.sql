@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip TEXT NOT NULL DEFAULT '',
+ADD COLUMN last_used_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+
+-- +goose Down
+DROP INDEX idx_refresh_tokens_user_id;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN last_used_at,
+DROP COLUMN ip,
+DROP COLUMN user_agent;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE revoked_access_tokens (
+    jti TEXT PRIMARY KEY,
+    user_id UUID NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX idx_revoked_access_tokens_expires_at ON revoked_access_tokens (expires_at);
+
+-- +goose Down
+DROP TABLE revoked_access_tokens;
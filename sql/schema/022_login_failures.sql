@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE login_failures (
+    scope TEXT NOT NULL,
+    identifier TEXT NOT NULL,
+    failures INTEGER NOT NULL,
+    last_failed_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (scope, identifier)
+);
+
+CREATE INDEX idx_login_failures_last_failed_at ON login_failures (last_failed_at);
+
+-- +goose Down
+DROP TABLE login_failures;
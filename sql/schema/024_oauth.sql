@@ -0,0 +1,50 @@
+-- +goose Up
+CREATE TABLE oauth_clients (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    name TEXT NOT NULL,
+    secret_hash TEXT,
+    redirect_uris TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX idx_oauth_clients_user_id ON oauth_clients (user_id);
+
+CREATE TABLE oauth_authorization_codes (
+    code_hash TEXT PRIMARY KEY,
+    client_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    code_challenge TEXT NOT NULL,
+    family_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    CONSTRAINT fk_client_id
+        FOREIGN KEY (client_id)
+        REFERENCES oauth_clients(id)
+        ON DELETE CASCADE,
+    CONSTRAINT fk_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+-- Refresh tokens issued to a client are limited to the scopes it was
+-- granted, tokens from a login have neither
+ALTER TABLE refresh_tokens
+ADD COLUMN client_id UUID REFERENCES oauth_clients(id) ON DELETE CASCADE,
+ADD COLUMN scopes TEXT[];
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN scopes,
+DROP COLUMN client_id;
+
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_clients;
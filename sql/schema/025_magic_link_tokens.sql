@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE magic_link_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL,
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    CONSTRAINT fk_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX idx_magic_link_tokens_user_id ON magic_link_tokens (user_id);
+
+-- +goose Down
+DROP TABLE magic_link_tokens;
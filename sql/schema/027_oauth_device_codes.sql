@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE oauth_device_codes (
+    device_code_hash TEXT PRIMARY KEY,
+    user_code TEXT NOT NULL UNIQUE,
+    client_id UUID NOT NULL,
+    scopes TEXT[] NOT NULL,
+    family_id UUID NOT NULL,
+    user_id UUID,
+    poll_interval INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    last_polled_at TIMESTAMP,
+    approved_at TIMESTAMP,
+    denied_at TIMESTAMP,
+    used_at TIMESTAMP,
+    CONSTRAINT fk_client_id
+        FOREIGN KEY (client_id)
+        REFERENCES oauth_clients(id)
+        ON DELETE CASCADE,
+    CONSTRAINT fk_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE oauth_device_codes;
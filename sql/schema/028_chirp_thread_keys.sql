@@ -0,0 +1,23 @@
+-- +goose Up
+-- Roots deleted before root_id had a foreign key leave replies without one
+UPDATE chirps
+SET root_id = NULL
+WHERE root_id IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM chirps root WHERE root.id = chirps.root_id);
+
+ALTER TABLE chirps
+ADD CONSTRAINT fk_root_id
+    FOREIGN KEY (root_id)
+    REFERENCES chirps(id)
+    ON DELETE SET NULL;
+
+-- Replies are paged per parent in the order they were posted
+DROP INDEX idx_chirps_in_reply_to;
+CREATE INDEX idx_chirps_in_reply_to_created_at ON chirps (in_reply_to, created_at, id);
+
+-- +goose Down
+DROP INDEX idx_chirps_in_reply_to_created_at;
+CREATE INDEX idx_chirps_in_reply_to ON chirps (in_reply_to);
+
+ALTER TABLE chirps
+DROP CONSTRAINT fk_root_id;
@@ -0,0 +1,34 @@
+-- +goose Up
+-- Replies and likes used to be able to land on rechirps, and were lost when
+-- the rechirp was undone. Move them onto the originals that still exist.
+UPDATE chirps
+SET root_id = CASE WHEN original.in_reply_to IS NULL THEN original.id ELSE original.root_id END
+FROM chirps rechirp
+JOIN chirps original ON original.id = rechirp.rechirp_of
+WHERE chirps.root_id = rechirp.id;
+
+UPDATE chirps
+SET in_reply_to = original.id
+FROM chirps rechirp
+JOIN chirps original ON original.id = rechirp.rechirp_of
+WHERE chirps.in_reply_to = rechirp.id;
+
+INSERT INTO chirp_likes (chirp_id, user_id, created_at)
+SELECT original.id, likes.user_id, likes.created_at
+FROM chirp_likes likes
+JOIN chirps rechirp ON rechirp.id = likes.chirp_id
+JOIN chirps original ON original.id = rechirp.rechirp_of
+ON CONFLICT (chirp_id, user_id) DO NOTHING;
+
+DELETE FROM chirp_likes
+USING chirps rechirp
+WHERE chirp_likes.chirp_id = rechirp.id AND rechirp.rechirp_of IS NOT NULL;
+
+UPDATE chirps
+SET reply_count = (SELECT COUNT(*) FROM chirps reply WHERE reply.in_reply_to = chirps.id),
+    like_count = (SELECT COUNT(*) FROM chirp_likes likes WHERE likes.chirp_id = chirps.id)
+WHERE rechirp_of IS NOT NULL
+   OR id IN (SELECT rechirp_of FROM chirps WHERE rechirp_of IS NOT NULL);
+
+-- +goose Down
+-- The replies and likes can't be told apart from ones made on the originals
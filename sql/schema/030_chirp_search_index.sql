@@ -0,0 +1,18 @@
+-- +goose Up
+-- The stored tsvector came back with every chirp read. Index the
+-- expression instead, search queries use the same expression.
+DROP INDEX idx_chirps_search;
+
+ALTER TABLE chirps
+DROP COLUMN search;
+
+CREATE INDEX idx_chirps_search ON chirps USING GIN (to_tsvector('english'::regconfig, body));
+
+-- +goose Down
+DROP INDEX idx_chirps_search;
+
+ALTER TABLE chirps
+ADD COLUMN search TSVECTOR
+    GENERATED ALWAYS AS (to_tsvector('english'::regconfig, body)) STORED;
+
+CREATE INDEX idx_chirps_search ON chirps USING GIN (search);
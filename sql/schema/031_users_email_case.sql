@@ -0,0 +1,31 @@
+-- +goose Up
+-- Emails are stored in lower case and compared without case. Accounts that
+-- only differ by case are left as they are, and must be merged or renamed by
+-- hand before the index below can be created.
+UPDATE users
+SET email = lower(email), updated_at = NOW()
+WHERE email <> lower(email)
+  AND NOT EXISTS (
+    SELECT 1 FROM users other
+    WHERE other.id <> users.id AND lower(other.email) = lower(users.email)
+  );
+
+-- Keep pending links working for the accounts that were changed
+UPDATE email_verification_tokens
+SET email = users.email
+FROM users
+WHERE users.id = email_verification_tokens.user_id
+  AND lower(email_verification_tokens.email) = users.email
+  AND email_verification_tokens.email <> users.email;
+
+UPDATE magic_link_tokens
+SET email = users.email
+FROM users
+WHERE users.id = magic_link_tokens.user_id
+  AND lower(magic_link_tokens.email) = users.email
+  AND magic_link_tokens.email <> users.email;
+
+CREATE UNIQUE INDEX idx_users_email_lower ON users (lower(email));
+
+-- +goose Down
+DROP INDEX idx_users_email_lower;